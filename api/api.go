@@ -4,13 +4,20 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/Masterminds/semver"
+	"github.com/Southclaws/sampctl/pawnpackage"
 	"github.com/go-chi/chi"
 	"github.com/gorilla/handlers"
+	"github.com/pkg/errors"
 	"go.uber.org/zap"
 
+	"github.com/Southclaws/pawndex/pawn"
+	"github.com/Southclaws/pawndex/resolver"
+	"github.com/Southclaws/pawndex/scraper"
 	"github.com/Southclaws/pawndex/storage"
 )
 
@@ -22,8 +29,13 @@ func (s *Server) Run() error {
 	return s.server.ListenAndServe()
 }
 
-func New(bind string, store storage.Storer) Server {
+// New creates the API server. Submitted repositories are checked to exist with checker, unless it's
+// nil in which case they're marked for scraping as is, and each client's submissions are limited by
+// limit. The /admin routes require adminToken as a bearer token and are disabled without one.
+func New(bind string, store storage.Storer, checker scraper.Checker, hook GitHubWebhook, limit SubmitLimit, adminToken string) Server {
 	router := chi.NewMux()
+	resolve := resolver.Resolver{Storer: store}
+	submits := &limiter{limit: limit}
 
 	router.Use(func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -32,14 +44,30 @@ func New(bind string, store storage.Storer) Server {
 		})
 	})
 
+	admin := router.With(adminOnly(adminToken))
+
 	router.Get("/", func(w http.ResponseWriter, r *http.Request) {
-		all, err := store.GetAll()
+		query, err := queryFromRequest(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		all, next, err := store.Query(query)
 		if err != nil {
 			zap.L().Error("failed to handle request", zap.Error(err))
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
+		if next != "" {
+			u := *r.URL
+			q := u.Query()
+			q.Set("cursor", next)
+			u.RawQuery = q.Encode()
+			w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="next"`, u.RequestURI()))
+		}
+
 		if err := json.NewEncoder(w).Encode(all); err != nil {
 			zap.L().Error("failed to handle request", zap.Error(err))
 			http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -47,11 +75,50 @@ func New(bind string, store storage.Storer) Server {
 		}
 	})
 
-	router.Get("/package/{user}/{repo}", func(w http.ResponseWriter, r *http.Request) {
-		user := chi.URLParam(r, "user")
-		repo := chi.URLParam(r, "repo")
+	router.Get("/search", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query().Get("q")
+		if query == "" {
+			http.Error(w, "Missing query parameter q", http.StatusBadRequest)
+			return
+		}
+
+		results, err := store.Search(query)
+		if err != nil {
+			zap.L().Error("failed to handle request", zap.Error(err))
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(results); err != nil {
+			zap.L().Error("failed to handle request", zap.Error(err))
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	})
 
-		p, exists, err := store.Get(fmt.Sprintf("%s/%s", user, repo))
+	router.Get("/symbols", func(w http.ResponseWriter, r *http.Request) {
+		name := r.URL.Query().Get("name")
+		if name == "" {
+			http.Error(w, "Missing query parameter name", http.StatusBadRequest)
+			return
+		}
+
+		symbols, err := store.GetSymbols(name)
+		if err != nil {
+			zap.L().Error("failed to handle request", zap.Error(err))
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(symbols); err != nil {
+			zap.L().Error("failed to handle request", zap.Error(err))
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	})
+
+	router.Get("/package/{user}/{repo}", func(w http.ResponseWriter, r *http.Request) {
+		p, exists, err := store.Get(packageName(r))
 		if err != nil {
 			zap.L().Error("failed to handle request", zap.Error(err))
 			http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -63,18 +130,73 @@ func New(bind string, store storage.Storer) Server {
 			return
 		}
 
-		if err := json.NewEncoder(w).Encode(p); err != nil {
+		conflicts, err := store.GetPackageConflicts(p.String())
+		if err != nil {
+			zap.L().Error("failed to handle request", zap.Error(err))
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		discovery, err := store.GetDiscovery(p.String())
+		if err != nil {
+			zap.L().Error("failed to handle request", zap.Error(err))
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		scraped, err := store.GetScraped(p.String())
+		if err != nil {
+			zap.L().Error("failed to handle request", zap.Error(err))
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(struct {
+			pawn.Package
+			Conflicts []pawn.Conflict     `json:"conflicts"`
+			Discovery []storage.Discovery `json:"discovery"`
+			Scraped   *time.Time          `json:"scraped"`
+		}{p, conflicts, discovery, timeOrNil(scraped)}); err != nil {
 			zap.L().Error("failed to handle request", zap.Error(err))
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 	})
 
-	router.Get("/package/{user}/{repo}/latest", func(w http.ResponseWriter, r *http.Request) {
-		user := chi.URLParam(r, "user")
-		repo := chi.URLParam(r, "repo")
+	router.Get("/package/{user}/{repo}/dependents", func(w http.ResponseWriter, r *http.Request) {
+		dependents, err := store.GetDependents(packageName(r))
+		if err != nil {
+			zap.L().Error("failed to handle request", zap.Error(err))
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
 
-		p, exists, err := store.Get(fmt.Sprintf("%s/%s", user, repo))
+		if err := json.NewEncoder(w).Encode(dependents); err != nil {
+			zap.L().Error("failed to handle request", zap.Error(err))
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	})
+
+	router.Get("/package/{user}/{repo}/versions", func(w http.ResponseWriter, r *http.Request) {
+		versions, err := store.GetVersions(packageName(r))
+		if err != nil {
+			zap.L().Error("failed to handle request", zap.Error(err))
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(versions); err != nil {
+			zap.L().Error("failed to handle request", zap.Error(err))
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	})
+
+	router.Get("/package/{user}/{repo}/versions/{tag}", func(w http.ResponseWriter, r *http.Request) {
+		tag := chi.URLParam(r, "tag")
+
+		p, exists, err := store.GetVersion(packageName(r), tag)
 		if err != nil {
 			zap.L().Error("failed to handle request", zap.Error(err))
 			http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -82,21 +204,57 @@ func New(bind string, store storage.Storer) Server {
 		}
 
 		if !exists {
-			http.Error(w, "Package not found", http.StatusNotFound)
+			http.Error(w, "Version not found", http.StatusNotFound)
 			return
 		}
 
-		if len(p.Tags) == 0 {
-			w.WriteHeader(http.StatusNoContent)
+		if err := json.NewEncoder(w).Encode(p); err != nil {
+			zap.L().Error("failed to handle request", zap.Error(err))
+			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		latest, err := semver.NewVersion(p.Tags[0])
+	})
+
+	router.Get("/package/{user}/{repo}/latest", func(w http.ResponseWriter, r *http.Request) {
+		p, exists, err := store.Get(packageName(r))
 		if err != nil {
 			zap.L().Error("failed to handle request", zap.Error(err))
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
+		if !exists {
+			http.Error(w, "Package not found", http.StatusNotFound)
+			return
+		}
+
+		var constraint *semver.Constraints
+		if c := r.URL.Query().Get("constraint"); c != "" {
+			constraint, err = semver.NewConstraint(c)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		prerelease, _ := strconv.ParseBool(r.URL.Query().Get("prerelease"))
+
+		tag, latest, ok := pawn.LatestVersion(p.Tags, constraint, prerelease)
+		if !ok {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		if strings.Contains(r.Header.Get("Accept"), "application/json") {
+			if err := json.NewEncoder(w).Encode(struct {
+				Tag     string `json:"tag"`
+				Version string `json:"version"`
+			}{tag, latest.String()}); err != nil {
+				zap.L().Error("failed to handle request", zap.Error(err))
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+
 		w.Header().Set("Content-Type", "application/octet-stream")
 		_, err = w.Write([]byte{
 			byte(latest.Major()),
@@ -110,6 +268,185 @@ func New(bind string, store storage.Storer) Server {
 		}
 	})
 
+	router.Get("/conflicts", func(w http.ResponseWriter, r *http.Request) {
+		conflicts, err := store.GetConflicts()
+		if err != nil {
+			zap.L().Error("failed to handle request", zap.Error(err))
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(conflicts); err != nil {
+			zap.L().Error("failed to handle request", zap.Error(err))
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	})
+
+	admin.Get("/admin/coverage", func(w http.ResponseWriter, r *http.Request) {
+		coverage, err := store.GetCoverage()
+		if err != nil {
+			zap.L().Error("failed to handle request", zap.Error(err))
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(coverage); err != nil {
+			zap.L().Error("failed to handle request", zap.Error(err))
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	})
+
+	admin.Get("/admin/queries", func(w http.ResponseWriter, r *http.Request) {
+		queries, err := store.GetQueries()
+		if err != nil {
+			zap.L().Error("failed to handle request", zap.Error(err))
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(queries); err != nil {
+			zap.L().Error("failed to handle request", zap.Error(err))
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	})
+
+	router.Post("/submit", submits.middleware(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Package string `json:"package"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		meta, err := pawn.ParseLocation(body.Package)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		name := pawn.Name(meta.Site, meta.User, meta.Repo)
+		if checker != nil {
+			canonical, exists, err := checker.Lookup(r.Context(), name)
+			if err != nil {
+				zap.L().Error("failed to handle request", zap.Error(err))
+				http.Error(w, err.Error(), http.StatusBadGateway)
+				return
+			}
+			if !exists {
+				http.Error(w, "Repository not found", http.StatusUnprocessableEntity)
+				return
+			}
+			name = canonical
+		}
+
+		submission, err := store.Submit(name)
+		if err != nil {
+			zap.L().Error("failed to handle request", zap.Error(err))
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Location", "/submit/"+submission.ID)
+		w.WriteHeader(http.StatusAccepted)
+		if err := json.NewEncoder(w).Encode(submission); err != nil {
+			zap.L().Error("failed to handle request", zap.Error(err))
+			return
+		}
+	}))
+
+	router.Get("/submit/{id}", func(w http.ResponseWriter, r *http.Request) {
+		submission, exists, err := store.GetSubmission(chi.URLParam(r, "id"))
+		if err != nil {
+			zap.L().Error("failed to handle request", zap.Error(err))
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if !exists {
+			http.Error(w, "Submission not found", http.StatusNotFound)
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(submission); err != nil {
+			zap.L().Error("failed to handle request", zap.Error(err))
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	})
+
+	admin.Get("/admin/failures", func(w http.ResponseWriter, r *http.Request) {
+		failures, err := store.GetFailures()
+		if err != nil {
+			zap.L().Error("failed to handle request", zap.Error(err))
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(failures); err != nil {
+			zap.L().Error("failed to handle request", zap.Error(err))
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	})
+
+	if hook.Secret != "" {
+		router.Post("/hooks/github", githubWebhook(store, hook))
+	}
+
+	router.Get("/includes/{name}", func(w http.ResponseWriter, r *http.Request) {
+		includes, err := store.GetIncludes(chi.URLParam(r, "name"))
+		if err != nil {
+			zap.L().Error("failed to handle request", zap.Error(err))
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(includes); err != nil {
+			zap.L().Error("failed to handle request", zap.Error(err))
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	})
+
+	router.Post("/resolve", func(w http.ResponseWriter, r *http.Request) {
+		var body json.RawMessage
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// the body is either a package definition or a plain list of dependency strings
+		var (
+			root pawnpackage.Package
+			err  error
+		)
+		if len(body) > 0 && body[0] == '[' {
+			err = json.Unmarshal(body, &root.Dependencies)
+		} else {
+			err = json.Unmarshal(body, &root)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		result, err := resolve.Resolve(root)
+		if err != nil {
+			zap.L().Error("failed to handle request", zap.Error(err))
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(result); err != nil {
+			zap.L().Error("failed to handle request", zap.Error(err))
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	})
+
 	return Server{http.Server{
 		Addr: bind,
 		Handler: handlers.CORS(
@@ -130,3 +467,52 @@ func New(bind string, store storage.Storer) Server {
 		IdleTimeout: time.Minute,
 	}}
 }
+
+// queryFromRequest builds a storage query from the listing's URL query parameters
+func queryFromRequest(r *http.Request) (query storage.Query, err error) {
+	values := r.URL.Query()
+
+	query.Classification = pawn.Classification(values.Get("classification"))
+	query.Topic = values.Get("topic")
+	query.User = values.Get("user")
+	query.Sort = storage.Sort(values.Get("sort"))
+	query.Cursor = values.Get("cursor")
+
+	if s := values.Get("updated_since"); s != "" {
+		if query.UpdatedSince, err = time.Parse(time.RFC3339, s); err != nil {
+			return query, errors.Wrap(err, "invalid updated_since")
+		}
+	}
+	if s := values.Get("min_stars"); s != "" {
+		if query.MinStars, err = strconv.Atoi(s); err != nil {
+			return query, errors.Wrap(err, "invalid min_stars")
+		}
+	}
+	if s := values.Get("limit"); s != "" {
+		if query.Limit, err = strconv.Atoi(s); err != nil || query.Limit < 1 {
+			return query, errors.New("invalid limit")
+		}
+	}
+
+	switch query.Sort {
+	case "", storage.SortName, storage.SortStars, storage.SortUpdated:
+	default:
+		return query, errors.Errorf("invalid sort '%s'", query.Sort)
+	}
+
+	return query, nil
+}
+
+// packageName builds the name of the package a request refers to from the user and repo URL
+// parameters and the optional site query parameter, which defaults to GitHub.
+func packageName(r *http.Request) string {
+	return pawn.Name(r.URL.Query().Get("site"), chi.URLParam(r, "user"), chi.URLParam(r, "repo"))
+}
+
+// timeOrNil returns nil for the zero time, so it's encoded as null
+func timeOrNil(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// SubmitLimit limits how many repositories each client can submit, clients are told by address
+type SubmitLimit struct {
+	// Requests is the number of submissions a client can make each Period, zero is no limit
+	Requests int
+	Period   time.Duration
+}
+
+// limiter counts the requests of each client in fixed windows of the limit's period
+type limiter struct {
+	limit SubmitLimit
+
+	mu      sync.Mutex
+	windows map[string]*clientWindow
+}
+
+// clientWindow is the requests a client has made in its current window
+type clientWindow struct {
+	start time.Time
+	count int
+}
+
+// allow counts a request from the client and reports whether it's within the limit, if not retry is
+// the time until the client's window resets
+func (l *limiter) allow(client string, now time.Time) (ok bool, retry time.Duration) {
+	if l.limit.Requests <= 0 {
+		return true, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.windows == nil {
+		l.windows = map[string]*clientWindow{}
+	}
+	w, exists := l.windows[client]
+	if !exists || now.Sub(w.start) >= l.limit.Period {
+		// windows of clients that have gone quiet are dropped with the first new window after them
+		for c, w := range l.windows {
+			if now.Sub(w.start) >= l.limit.Period {
+				delete(l.windows, c)
+			}
+		}
+		w = &clientWindow{start: now}
+		l.windows[client] = w
+	}
+	if w.count >= l.limit.Requests {
+		return false, w.start.Add(l.limit.Period).Sub(now)
+	}
+	w.count++
+	return true, 0
+}
+
+// middleware rejects requests over the limit with 429 Too Many Requests. Clients are told apart by
+// the address they connect from, forwarded addresses can be set by anyone so they're ignored.
+func (l *limiter) middleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		client, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			client = r.RemoteAddr
+		}
+		if ok, retry := l.allow(client, time.Now()); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retry.Seconds()))))
+			http.Error(w, "Too many submissions, try again later", http.StatusTooManyRequests)
+			return
+		}
+		next(w, r)
+	}
+}
@@ -0,0 +1,64 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	l := &limiter{limit: SubmitLimit{Requests: 2, Period: time.Hour}}
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		client    string
+		now       time.Time
+		wantOK    bool
+		wantRetry time.Duration
+	}{
+		{"first", "a", start, true, 0},
+		{"second", "a", start.Add(time.Minute), true, 0},
+		{"over limit", "a", start.Add(2 * time.Minute), false, 58 * time.Minute},
+		{"other client", "b", start.Add(2 * time.Minute), true, 0},
+		{"next window", "a", start.Add(time.Hour), true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, retry := l.allow(tt.client, tt.now)
+			if ok != tt.wantOK || retry != tt.wantRetry {
+				t.Errorf("limiter.allow() = %v, %v, want %v, %v", ok, retry, tt.wantOK, tt.wantRetry)
+			}
+		})
+	}
+
+	// a quiet client's window is dropped once another starts
+	if _, exists := l.windows["b"]; !exists {
+		t.Error("window of b dropped before its period")
+	}
+	l.allow("c", start.Add(3*time.Hour))
+	if len(l.windows) != 1 {
+		t.Errorf("windows = %v, want only c", l.windows)
+	}
+}
+
+func TestLimiter_middleware(t *testing.T) {
+	l := &limiter{limit: SubmitLimit{Requests: 1, Period: time.Hour}}
+	handler := l.middleware(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+	for _, want := range []int{http.StatusAccepted, http.StatusTooManyRequests} {
+		r := httptest.NewRequest(http.MethodPost, "/submit", nil)
+		r.RemoteAddr = "192.0.2.1:1234"
+		w := httptest.NewRecorder()
+		handler(w, r)
+		if w.Code != want {
+			t.Errorf("status = %d, want %d", w.Code, want)
+		}
+		if w.Code == http.StatusTooManyRequests && w.Header().Get("Retry-After") != "3600" {
+			t.Errorf("Retry-After = %q, want 3600", w.Header().Get("Retry-After"))
+		}
+	}
+}
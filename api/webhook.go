@@ -0,0 +1,218 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/Southclaws/pawndex/pawn"
+	"github.com/Southclaws/pawndex/storage"
+)
+
+// maxWebhookPayload is the largest event payload read, GitHub caps payloads at 25MB
+const maxWebhookPayload = 25 << 20
+
+// GitHubWebhook configures the receiver of GitHub webhook events at /hooks/github, such as those
+// of a GitHub App installed on package repositories
+type GitHubWebhook struct {
+	// Secret verifies the signature of each event, the receiver is disabled without one
+	Secret string
+	// Site is the host of the GitHub instance events come from, defaults to github.com
+	Site string
+	// Refresh is sent each repository an event marks for scraping so it's scraped right away, the
+	// send is skipped if it would block
+	Refresh chan<- string
+}
+
+// githubRepository is the part of a repository in an event payload that names it
+type githubRepository struct {
+	FullName      string `json:"full_name"`
+	DefaultBranch string `json:"default_branch"`
+}
+
+type githubLogin struct {
+	Login string `json:"login"`
+}
+
+// githubEvent holds the fields of the handled events' payloads
+type githubEvent struct {
+	Action     string            `json:"action"`
+	Ref        string            `json:"ref"`      // push and create
+	RefType    string            `json:"ref_type"` // create
+	Repository *githubRepository `json:"repository"`
+	Changes    struct {
+		Repository struct {
+			Name struct {
+				From string `json:"from"`
+			} `json:"name"`
+		} `json:"repository"` // renamed
+		Owner struct {
+			From struct {
+				User         *githubLogin `json:"user"`
+				Organization *githubLogin `json:"organization"`
+			} `json:"from"`
+		} `json:"owner"` // transferred
+	} `json:"changes"`
+	Repositories      []githubRepository `json:"repositories"`       // installation
+	RepositoriesAdded []githubRepository `json:"repositories_added"` // installation_repositories
+}
+
+// affected returns the repositories a GitHub event changes, as user/repo names. Those in mark need
+// scraping and those in remove no longer exist under that name.
+func (e githubEvent) affected(event string) (mark, remove []string) {
+	switch event {
+	case "push":
+		if e.Repository == nil {
+			return
+		}
+		if strings.HasPrefix(e.Ref, "refs/tags/") || e.Ref == "refs/heads/"+e.Repository.DefaultBranch {
+			mark = append(mark, e.Repository.FullName)
+		}
+
+	case "create":
+		if e.Repository != nil && e.RefType == "tag" {
+			mark = append(mark, e.Repository.FullName)
+		}
+
+	case "release":
+		if e.Repository != nil {
+			mark = append(mark, e.Repository.FullName)
+		}
+
+	case "repository":
+		if e.Repository == nil {
+			return
+		}
+		owner, name := splitFullName(e.Repository.FullName)
+		switch e.Action {
+		case "renamed":
+			remove = append(remove, owner+"/"+e.Changes.Repository.Name.From)
+			mark = append(mark, e.Repository.FullName)
+		case "transferred":
+			from := e.Changes.Owner.From.User
+			if from == nil {
+				from = e.Changes.Owner.From.Organization
+			}
+			if from != nil {
+				remove = append(remove, from.Login+"/"+name)
+			}
+			mark = append(mark, e.Repository.FullName)
+		case "archived", "unarchived":
+			mark = append(mark, e.Repository.FullName)
+		case "deleted":
+			remove = append(remove, e.Repository.FullName)
+		}
+
+	case "installation":
+		if e.Action == "created" {
+			for _, r := range e.Repositories {
+				mark = append(mark, r.FullName)
+			}
+		}
+
+	case "installation_repositories":
+		if e.Action == "added" {
+			for _, r := range e.RepositoriesAdded {
+				mark = append(mark, r.FullName)
+			}
+		}
+	}
+	return
+}
+
+func splitFullName(fullName string) (owner, name string) {
+	if i := strings.Index(fullName, "/"); i != -1 {
+		return fullName[:i], fullName[i+1:]
+	}
+	return "", fullName
+}
+
+// githubName returns the package name of a repository named by an event
+func githubName(site, fullName string) string {
+	owner, name := splitFullName(fullName)
+	return pawn.Name(site, owner, name)
+}
+
+// validSignature checks the X-Hub-Signature-256 header of an event is the HMAC of its payload
+func validSignature(header string, payload []byte, secret string) bool {
+	if !strings.HasPrefix(header, "sha256=") {
+		return false
+	}
+	signature, err := hex.DecodeString(strings.TrimPrefix(header, "sha256="))
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hmac.Equal(signature, mac.Sum(nil))
+}
+
+// githubWebhook handles GitHub webhook events by removing repositories that no longer exist and
+// marking changed repositories for scraping
+func githubWebhook(store storage.Storer, hook GitHubWebhook) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// the route is open to anyone until the signature is checked, so the payload is limited
+		payload, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookPayload))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		if !validSignature(r.Header.Get("X-Hub-Signature-256"), payload, hook.Secret) {
+			http.Error(w, "Invalid signature", http.StatusUnauthorized)
+			return
+		}
+
+		var e githubEvent
+		if err := json.Unmarshal(payload, &e); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		event := r.Header.Get("X-GitHub-Event")
+		mark, remove := e.affected(event)
+		result := struct {
+			Event   string   `json:"event"`
+			Marked  []string `json:"marked"`
+			Removed []string `json:"removed"`
+		}{event, []string{}, []string{}}
+
+		for _, name := range remove {
+			name = githubName(hook.Site, name)
+			if err := store.Delete(name); err != nil {
+				zap.L().Error("failed to handle request", zap.Error(err))
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			result.Removed = append(result.Removed, name)
+		}
+		for _, name := range mark {
+			name = githubName(hook.Site, name)
+			if err := store.MarkFound(name, storage.Discovery{Source: storage.SourceWebhook}); err != nil {
+				zap.L().Error("failed to handle request", zap.Error(err))
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			select {
+			case hook.Refresh <- name:
+			default:
+				// the next scrape picks it up
+			}
+			result.Marked = append(result.Marked, name)
+		}
+
+		zap.L().Debug("handled github webhook event", zap.String("event", event),
+			zap.Strings("marked", result.Marked), zap.Strings("removed", result.Removed))
+
+		if err := json.NewEncoder(w).Encode(result); err != nil {
+			zap.L().Error("failed to handle request", zap.Error(err))
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Southclaws/sampctl/pawnpackage"
+	"github.com/Southclaws/sampctl/versioning"
+
+	"github.com/Southclaws/pawndex/pawn"
+	"github.com/Southclaws/pawndex/storagetest"
+)
+
+func sign(payload, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestGitHubWebhook(t *testing.T) {
+	store := storagetest.NewStore(t)
+
+	if err := store.Set(pawn.Package{
+		Package: pawnpackage.Package{
+			DependencyMeta: versioning.DependencyMeta{Site: "github.com", User: "Southclaws", Repo: "old-name"},
+		},
+		Classification: pawn.ClassificationBarebones,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	refresh := make(chan string, 10)
+	handler := githubWebhook(store, GitHubWebhook{Secret: "secret", Refresh: refresh})
+
+	tests := []struct {
+		name        string
+		event       string
+		payload     string
+		signature   string
+		wantStatus  int
+		wantMarked  []string
+		wantRemoved []string
+	}{
+		{"bad signature", "push", `{"ref":"refs/heads/master","repository":{"full_name":"a/b","default_branch":"master"}}`,
+			sign("{}", "secret"), http.StatusUnauthorized, nil, nil},
+		{"payload too large", "push", strings.Repeat(" ", maxWebhookPayload+1),
+			"", http.StatusRequestEntityTooLarge, nil, nil},
+		{"push to default branch", "push", `{"ref":"refs/heads/master","repository":{"full_name":"a/b","default_branch":"master"}}`,
+			"", http.StatusOK, []string{"github.com/a/b"}, nil},
+		{"push to other branch", "push", `{"ref":"refs/heads/wip","repository":{"full_name":"a/b","default_branch":"master"}}`,
+			"", http.StatusOK, nil, nil},
+		{"push tag", "push", `{"ref":"refs/tags/1.0.0","repository":{"full_name":"a/b","default_branch":"master"}}`,
+			"", http.StatusOK, []string{"github.com/a/b"}, nil},
+		{"create tag", "create", `{"ref":"1.0.0","ref_type":"tag","repository":{"full_name":"a/b"}}`,
+			"", http.StatusOK, []string{"github.com/a/b"}, nil},
+		{"create branch", "create", `{"ref":"wip","ref_type":"branch","repository":{"full_name":"a/b"}}`,
+			"", http.StatusOK, nil, nil},
+		{"release", "release", `{"action":"published","repository":{"full_name":"a/b"}}`,
+			"", http.StatusOK, []string{"github.com/a/b"}, nil},
+		{"renamed", "repository", `{"action":"renamed","repository":{"full_name":"Southclaws/new-name"},"changes":{"repository":{"name":{"from":"old-name"}}}}`,
+			"", http.StatusOK, []string{"github.com/Southclaws/new-name"}, []string{"github.com/Southclaws/old-name"}},
+		{"transferred", "repository", `{"action":"transferred","repository":{"full_name":"org/lib"},"changes":{"owner":{"from":{"user":{"login":"someone"}}}}}`,
+			"", http.StatusOK, []string{"github.com/org/lib"}, []string{"github.com/someone/lib"}},
+		{"archived", "repository", `{"action":"archived","repository":{"full_name":"a/b"}}`,
+			"", http.StatusOK, []string{"github.com/a/b"}, nil},
+		{"deleted", "repository", `{"action":"deleted","repository":{"full_name":"a/b"}}`,
+			"", http.StatusOK, nil, []string{"github.com/a/b"}},
+		{"installation", "installation", `{"action":"created","repositories":[{"full_name":"a/b"},{"full_name":"a/c"}]}`,
+			"", http.StatusOK, []string{"github.com/a/b", "github.com/a/c"}, nil},
+		{"installation repositories", "installation_repositories", `{"action":"added","repositories_added":[{"full_name":"a/d"}]}`,
+			"", http.StatusOK, []string{"github.com/a/d"}, nil},
+		{"ping", "ping", `{"zen":"Keep it logically awesome."}`,
+			"", http.StatusOK, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signature := tt.signature
+			if signature == "" {
+				signature = sign(tt.payload, "secret")
+			}
+			req := httptest.NewRequest(http.MethodPost, "/hooks/github", strings.NewReader(tt.payload))
+			req.Header.Set("X-GitHub-Event", tt.event)
+			req.Header.Set("X-Hub-Signature-256", signature)
+			rec := httptest.NewRecorder()
+			handler(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+
+			var gotMarked []string
+			for len(refresh) > 0 {
+				gotMarked = append(gotMarked, <-refresh)
+			}
+			if !reflect.DeepEqual(gotMarked, tt.wantMarked) {
+				t.Errorf("refreshed %v, want %v", gotMarked, tt.wantMarked)
+			}
+			for _, name := range tt.wantRemoved {
+				if _, exists, err := store.Get(name); err != nil || exists {
+					t.Errorf("%s exists = %v, %v, want removed", name, exists, err)
+				}
+			}
+		})
+	}
+
+	marked, err := store.GetMarked()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"github.com/Southclaws/new-name", "github.com/a/b", "github.com/a/c", "github.com/a/d", "github.com/org/lib"}
+	if !reflect.DeepEqual(marked, want) {
+		t.Errorf("marked = %v, want %v", marked, want)
+	}
+}
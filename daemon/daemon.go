@@ -2,8 +2,12 @@ package daemon
 
 import (
 	"context"
+	"fmt"
+	"math"
+	"sort"
 	"time"
 
+	"github.com/Southclaws/pawndex/pawn"
 	"github.com/Southclaws/pawndex/scraper"
 	"github.com/Southclaws/pawndex/searcher"
 	"github.com/Southclaws/pawndex/storage"
@@ -12,32 +16,81 @@ import (
 
 type Daemon struct {
 	Searcher       searcher.Searcher
+	CodeSearcher   searcher.Searcher // runs code search queries, they are skipped if it's nil
 	Scraper        scraper.Scraper
 	Storer         storage.Storer
 	SearchInterval time.Duration
 	ScrapeInterval time.Duration
+	// FullSearchInterval is the time between full searches, the searches in between only look for
+	// repositories pushed to since the last successful search. Zero makes every search full.
+	FullSearchInterval time.Duration
+	// Queries discover repositories, defaults to DefaultQueries
+	Queries []Query
+	// CrawlInterval is the time between crawls of the dependencies of indexed packages for
+	// repositories that aren't indexed yet, zero disables crawling.
+	CrawlInterval time.Duration
+	// CrawlDepth limits how many dependencies away from a package found by searching a crawled
+	// package can be, CrawlLimit limits how many repositories each crawl marks for scraping.
+	CrawlDepth int
+	CrawlLimit int
+	// Refresh receives the names of repositories to scrape right away instead of waiting for the
+	// next scrape, such as those named by webhook events. They must be marked for scraping too.
+	Refresh <-chan string
+	// Workers is the number of repositories scraped at once, defaults to one
+	Workers int
+	// RetryBackoff is the time before a repository that failed to scrape is retried, doubled after
+	// each failure in a row up to MaxRetryBackoff. After MaxAttempts failures in a row the
+	// repository is given up on, zero retries forever.
+	RetryBackoff    time.Duration
+	MaxRetryBackoff time.Duration
+	MaxAttempts     int
+	// RefreshInterval is the time between checks for indexed packages due to be scraped again,
+	// zero disables refreshing. Each package is due somewhere between RefreshMin and RefreshMax
+	// after its last scrape, the more stars and the more recently updated the sooner. RefreshLimit
+	// limits how many packages each check marks, the most overdue first.
+	RefreshInterval time.Duration
+	RefreshMin      time.Duration
+	RefreshMax      time.Duration
+	RefreshLimit    int
 }
 
 func (d *Daemon) Run(ctx context.Context) {
 	search := time.NewTicker(d.SearchInterval)
 	scrape := time.NewTicker(d.ScrapeInterval)
+	var crawl <-chan time.Time
+	if d.CrawlInterval > 0 {
+		crawl = time.NewTicker(d.CrawlInterval).C
+	}
+	var refresh <-chan time.Time
+	if d.RefreshInterval > 0 {
+		refresh = time.NewTicker(d.RefreshInterval).C
+	}
+
+	// scraping happens in the workers so a slow repository doesn't hold up searches
+	jobs := newQueue()
+	workers := d.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		go func() {
+			for {
+				r, ok := jobs.pop(ctx)
+				if !ok {
+					return
+				}
+				d.scrape(ctx, r)
+				jobs.done(r)
+			}
+		}()
+	}
 
 	f := func() error {
 		select {
 		case <-search.C:
-			zap.L().Debug("starting search job")
-			repos, err := d.Searcher.Search("topic:pawn-package", "language:pawn", "topic:sa-mp")
-			if err != nil {
+			if err := d.search(); err != nil {
 				return err
 			}
-			zap.L().Debug("finished search", zap.Int("repos", len(repos)))
-			for _, r := range repos {
-				zap.L().Debug("marking for scrape job", zap.String("repo", r))
-				if err := d.Storer.MarkForScrape(r); err != nil {
-					zap.L().Error("failed to mark repo for scraping", zap.String("name", r), zap.Error(err))
-				}
-			}
-			zap.L().Debug("finished marking scrape jobs")
 
 		case <-scrape.C:
 			marked, err := d.Storer.GetMarked()
@@ -45,21 +98,23 @@ func (d *Daemon) Run(ctx context.Context) {
 				return err
 			}
 
-			zap.L().Debug("starting scrape jobs", zap.Int("repos", len(marked)))
+			zap.L().Debug("queueing scrape jobs", zap.Int("repos", len(marked)), zap.Int("waiting", jobs.len()))
 
 			for _, r := range marked {
-				zap.L().Debug("scraping repository", zap.String("repo", r))
-				pkg, err := d.Scraper.Scrape(ctx, r)
-				if err != nil {
-					zap.L().Error("failed to scrape repo",
-						zap.String("name", r), zap.Error(err))
-					continue
-				}
-				if err := d.Storer.Set(*pkg); err != nil {
-					zap.L().Error("failed to store scraped package data",
-						zap.String("name", r), zap.Error(err))
-					continue
-				}
+				jobs.push(r, false)
+			}
+
+		case r := <-d.Refresh:
+			jobs.push(r, true)
+
+		case <-crawl:
+			if err := d.crawl(ctx); err != nil {
+				return err
+			}
+
+		case <-refresh:
+			if err := d.refresh(time.Now()); err != nil {
+				return err
 			}
 
 		case <-ctx.Done():
@@ -77,3 +132,296 @@ func (d *Daemon) Run(ctx context.Context) {
 		}
 	}
 }
+
+// scrape scrapes a single repository and stores the package, or unmarks the repository if it
+// isn't one
+func (d *Daemon) scrape(ctx context.Context, r string) {
+	zap.L().Debug("scraping repository", zap.String("repo", r))
+	pkg, err := d.Scraper.Scrape(ctx, r)
+	if err != nil {
+		zap.L().Error("failed to scrape repo",
+			zap.String("name", r), zap.Error(err))
+		d.fail(r, err)
+		return
+	}
+	if pkg == nil {
+		zap.L().Debug("repository is not a package", zap.String("name", r))
+		if err := d.Storer.Unmark(r); err != nil {
+			zap.L().Error("failed to unmark repo", zap.String("name", r), zap.Error(err))
+		}
+		if err := d.Storer.RejectSubmissions(r, "repository is not a Pawn package"); err != nil {
+			zap.L().Error("failed to reject submissions", zap.String("name", r), zap.Error(err))
+		}
+		return
+	}
+	if err := d.Storer.Set(*pkg); err != nil {
+		zap.L().Error("failed to store scraped package data",
+			zap.String("name", r), zap.Error(err))
+		return
+	}
+
+	// the repository was renamed or marked with another spelling, so the package was stored under
+	// the host's name and the marked entry is finished with here
+	if name := pkg.String(); name != pawn.CanonicalName(r) {
+		zap.L().Debug("repository scraped under another name",
+			zap.String("name", r), zap.String("package", name))
+		if err := d.Storer.Unmark(r); err != nil {
+			zap.L().Error("failed to unmark repo", zap.String("name", r), zap.Error(err))
+		}
+		if err := d.Storer.ResolveSubmissions(r); err != nil {
+			zap.L().Error("failed to resolve submissions", zap.String("name", r), zap.Error(err))
+		}
+	}
+}
+
+// fail records a failed scrape and schedules the next attempt, or gives up on the repository once
+// it has failed MaxAttempts times in a row
+func (d *Daemon) fail(r string, scrapeErr error) {
+	f, _, err := d.Storer.GetFailure(r)
+	if err != nil {
+		zap.L().Error("failed to get repo failures", zap.String("name", r), zap.Error(err))
+		return
+	}
+
+	f.Error = scrapeErr.Error()
+	f.Attempts++
+	f.Last = time.Now().UTC()
+	f.NextAttempt = f.Last.Add(backoff(d.RetryBackoff, d.MaxRetryBackoff, f.Attempts))
+	f.Dead = d.MaxAttempts > 0 && f.Attempts >= d.MaxAttempts
+
+	if f.Dead {
+		zap.L().Warn("giving up on repo", zap.String("name", r), zap.Int("attempts", f.Attempts))
+		if err := d.Storer.RejectSubmissions(r, "failed to scrape: "+f.Error); err != nil {
+			zap.L().Error("failed to reject submissions", zap.String("name", r), zap.Error(err))
+		}
+	}
+	if err := d.Storer.SetFailure(r, f); err != nil {
+		zap.L().Error("failed to store repo failure", zap.String("name", r), zap.Error(err))
+	}
+}
+
+// backoff returns the time to wait after the given number of failures in a row, max of zero is
+// no limit
+func backoff(initial, max time.Duration, attempts int) time.Duration {
+	if max <= 0 {
+		max = math.MaxInt64 / 2
+	}
+	delay := initial
+	for i := 1; i < attempts && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+	return delay
+}
+
+// search runs each discovery query that is due and marks every result for scraping
+func (d *Daemon) search() error {
+	queries := d.Queries
+	if len(queries) == 0 {
+		queries = DefaultQueries
+	}
+
+	states, err := d.Storer.GetQueries()
+	if err != nil {
+		return err
+	}
+	byQuery := map[string]storage.QueryState{}
+	for _, st := range states {
+		byQuery[st.Query] = st
+	}
+
+	configured := map[string]bool{}
+	for _, q := range queries {
+		configured[q.Query] = true
+
+		st, ok := byQuery[q.Query]
+		if !ok {
+			st = storage.QueryState{Query: q.Query}
+		}
+		st.Code = q.Code
+		st.Interval = q.Interval
+		st.FullInterval = q.FullInterval
+		if st.FullInterval == 0 {
+			st.FullInterval = d.FullSearchInterval
+		}
+		if !st.LastRun.IsZero() && time.Since(st.LastRun) < st.Interval {
+			continue
+		}
+
+		d.runQuery(&st)
+		if err := d.Storer.SetQuery(st); err != nil {
+			zap.L().Error("failed to store query state", zap.String("query", q.Query), zap.Error(err))
+		}
+	}
+
+	// forget queries that have been removed from the configuration
+	for _, st := range states {
+		if !configured[st.Query] {
+			if err := d.Storer.DeleteQuery(st.Query); err != nil {
+				zap.L().Error("failed to delete query state", zap.String("query", st.Query), zap.Error(err))
+			}
+		}
+	}
+	return nil
+}
+
+// runQuery searches for a query and marks every result for scraping. Unless a full search is due,
+// only repositories pushed to since the last successful run are searched for.
+func (d *Daemon) runQuery(st *storage.QueryState) {
+	search, source := d.Searcher, storage.SourceSearch
+	if st.Code {
+		search, source = d.CodeSearcher, storage.SourceCodeSearch
+		if search == nil {
+			st.Error = "no code searcher configured"
+			return
+		}
+	}
+
+	started := time.Now().UTC()
+	full := st.Code || st.Last.IsZero() || started.Sub(st.LastFull) >= st.FullInterval
+	query := st.Query
+	if !full {
+		query = fmt.Sprintf("%s pushed:>%s", st.Query, st.Last.Format(time.RFC3339))
+	}
+
+	st.LastRun = started
+	st.Full = full
+
+	zap.L().Debug("starting search job", zap.String("query", query), zap.Bool("full", full))
+	repos, err := search.Search(query)
+	st.Hits = len(repos)
+	if err != nil {
+		zap.L().Error("search failed", zap.String("query", query), zap.Error(err))
+		st.Error = err.Error()
+		return
+	}
+	zap.L().Debug("finished search", zap.String("query", query), zap.Int("repos", len(repos)))
+
+	// a failed slice may have missed repositories, so the next search must cover the same window
+	st.Error = ""
+	if reporter, ok := search.(searcher.CoverageReporter); ok {
+		for _, c := range reporter.Coverage() {
+			if c.Time.Before(started) || c.Query != st.Query {
+				continue
+			}
+			if c.Failed > 0 {
+				st.Error = fmt.Sprintf("%d search slices failed", c.Failed)
+			}
+			if err := d.Storer.SetCoverage(c); err != nil {
+				zap.L().Error("failed to store search coverage", zap.String("query", c.Query), zap.Error(err))
+			}
+		}
+	}
+
+	for _, r := range repos {
+		zap.L().Debug("marking for scrape job", zap.String("repo", r))
+		if err := d.Storer.MarkFound(r, storage.Discovery{Source: source, Query: st.Query}); err != nil {
+			zap.L().Error("failed to mark repo for scraping", zap.String("name", r), zap.Error(err))
+			st.Error = "failed to mark results for scraping"
+		}
+	}
+	zap.L().Debug("finished marking scrape jobs")
+
+	if st.Error != "" {
+		return
+	}
+	st.Last = started
+	if full {
+		st.LastFull = started
+	}
+}
+
+// crawl marks the dependencies of indexed packages that aren't indexed themselves for scraping.
+// Once scraped, their own dependencies are found by the next crawl, up to CrawlDepth.
+func (d *Daemon) crawl(ctx context.Context) error {
+	deps, err := d.Storer.GetUnindexedDependencies(d.CrawlDepth)
+	if err != nil {
+		return err
+	}
+	zap.L().Debug("starting crawl job", zap.Int("dependencies", len(deps)))
+
+	if d.CrawlLimit > 0 && len(deps) > d.CrawlLimit {
+		deps = deps[:d.CrawlLimit]
+	}
+	// dependencies are named as the packages requiring them spell them, the scraped package is
+	// stored under the host's spelling so the dependency is marked under it
+	checker, _ := d.Scraper.(scraper.Checker)
+	for _, dep := range deps {
+		if checker != nil {
+			name, exists, err := checker.Lookup(ctx, dep.Name)
+			if err != nil {
+				zap.L().Error("failed to look up dependency", zap.String("name", dep.Name), zap.Error(err))
+				continue
+			}
+			if exists {
+				dep.Name = name
+			}
+		}
+		zap.L().Debug("marking dependency for scrape job",
+			zap.String("repo", dep.Name), zap.String("required_by", dep.RequiredBy), zap.Int("depth", dep.Depth))
+		if err := d.Storer.MarkDependency(dep); err != nil {
+			zap.L().Error("failed to mark dependency for scraping", zap.String("name", dep.Name), zap.Error(err))
+		}
+	}
+	zap.L().Debug("finished crawl job", zap.Int("marked", len(deps)))
+	return nil
+}
+
+// refresh marks the indexed packages that have gone longest without being scraped, relative to how
+// often they should be, for scraping again
+func (d *Daemon) refresh(now time.Time) error {
+	times, err := d.Storer.GetScrapeTimes()
+	if err != nil {
+		return err
+	}
+
+	// staleness is the time since the last scrape as a multiple of the package's refresh interval
+	type stale struct {
+		name      string
+		staleness float64
+	}
+	var due []stale
+	for _, t := range times {
+		s := math.Inf(1) // scraped before scrape times were recorded
+		if !t.Scraped.IsZero() {
+			s = float64(now.Sub(t.Scraped)) / float64(d.refreshInterval(t, now))
+		}
+		if s >= 1 {
+			due = append(due, stale{t.Name, s})
+		}
+	}
+	sort.SliceStable(due, func(i, j int) bool {
+		return due[i].staleness > due[j].staleness
+	})
+	zap.L().Debug("starting refresh job", zap.Int("packages", len(times)), zap.Int("due", len(due)))
+
+	if d.RefreshLimit > 0 && len(due) > d.RefreshLimit {
+		due = due[:d.RefreshLimit]
+	}
+	for _, s := range due {
+		if err := d.Storer.MarkStale(s.name); err != nil {
+			zap.L().Error("failed to mark stale package for scraping", zap.String("name", s.name), zap.Error(err))
+		}
+	}
+	zap.L().Debug("finished refresh job", zap.Int("marked", len(due)))
+	return nil
+}
+
+// refreshInterval returns how long after its last scrape a package is due to be scraped again.
+// RefreshMax is divided by a factor growing with the log of its stars, and again for packages
+// updated in the last month or year, then kept within RefreshMin.
+func (d *Daemon) refreshInterval(t storage.ScrapeTime, now time.Time) time.Duration {
+	interval := float64(d.RefreshMax) / (1 + math.Log2(1+float64(t.Stars)))
+	switch age := now.Sub(t.Updated); {
+	case age < 30*24*time.Hour:
+		interval /= 4
+	case age < 365*24*time.Hour:
+		interval /= 2
+	}
+	if interval < float64(d.RefreshMin) {
+		return d.RefreshMin
+	}
+	return time.Duration(interval)
+}
@@ -0,0 +1,428 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Southclaws/sampctl/pawnpackage"
+	"github.com/Southclaws/sampctl/versioning"
+
+	"github.com/Southclaws/pawndex/githubtest"
+	"github.com/Southclaws/pawndex/pawn"
+	"github.com/Southclaws/pawndex/searcher"
+	"github.com/Southclaws/pawndex/storage"
+	"github.com/Southclaws/pawndex/storagetest"
+)
+
+// recordingSearcher returns one result per query and records the queries it was given
+type recordingSearcher struct {
+	queries []string
+}
+
+func (r *recordingSearcher) Search(queries ...string) ([]string, error) {
+	r.queries = append(r.queries, queries...)
+	return []string{"github.com/test/" + strings.TrimPrefix(strings.Fields(queries[0])[0], "topic:")}, nil
+}
+
+func TestDaemon_search(t *testing.T) {
+	store := storagetest.NewStore(t)
+
+	search := &recordingSearcher{}
+	d := Daemon{
+		Searcher:           search,
+		Storer:             store,
+		FullSearchInterval: time.Hour,
+		Queries: []Query{
+			{Query: "topic:every"},
+			{Query: "topic:daily", Interval: 24 * time.Hour},
+		},
+	}
+
+	// the first search of every query is full
+	if err := d.search(); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"topic:every", "topic:daily"}; strings.Join(search.queries, ",") != strings.Join(want, ",") {
+		t.Errorf("first search queries = %v, want %v", search.queries, want)
+	}
+
+	// the next search only looks for recent activity and skips queries that aren't due
+	search.queries = nil
+	if err := d.search(); err != nil {
+		t.Fatal(err)
+	}
+	if len(search.queries) != 1 || !strings.HasPrefix(search.queries[0], "topic:every pushed:>") {
+		t.Errorf("second search queries = %v, want an incremental topic:every", search.queries)
+	}
+
+	states, err := store.GetQueries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(states) != 2 {
+		t.Fatalf("query states = %v, want two", states)
+	}
+	for _, st := range states {
+		if st.Hits != 1 || st.Last.IsZero() || st.LastFull.IsZero() || st.Error != "" {
+			t.Errorf("query state = %+v", st)
+		}
+	}
+	discovery, err := store.GetDiscovery("github.com/test/every")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(discovery) != 1 || discovery[0].Source != storage.SourceSearch || discovery[0].Query != "topic:every" {
+		t.Errorf("discovery = %v, want found by topic:every", discovery)
+	}
+
+	// removed queries are forgotten
+	d.Queries = d.Queries[:1]
+	if err := d.search(); err != nil {
+		t.Fatal(err)
+	}
+	states, err = store.GetQueries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(states) != 1 || states[0].Query != "topic:every" {
+		t.Errorf("query states = %v, want only topic:every", states)
+	}
+}
+
+func TestDaemon_searchFailure(t *testing.T) {
+	store := storagetest.NewStore(t)
+
+	server := githubtest.NewServer(githubtest.Repository{
+		Owner: "test", Name: "library", Topics: []string{"pawn-package"}, Pushed: time.Now(),
+	})
+	defer server.Close()
+
+	d := Daemon{
+		Searcher:           &searcher.GitHubSearcher{GitHub: server.GitHub()},
+		Storer:             store,
+		FullSearchInterval: time.Hour,
+		Queries:            []Query{{Query: "topic:pawn-package"}},
+	}
+	state := func() storage.QueryState {
+		states, err := store.GetQueries()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(states) != 1 {
+			t.Fatalf("query states = %v, want one", states)
+		}
+		return states[0]
+	}
+
+	if err := d.search(); err != nil {
+		t.Fatal(err)
+	}
+	before := state()
+	if before.Error != "" || before.Last.IsZero() {
+		t.Fatalf("query state after search = %+v", before)
+	}
+
+	// an incremental search that fails on its first request must be repeated over the same window
+	server.Fail(1)
+	if err := d.search(); err != nil {
+		t.Fatal(err)
+	}
+	failed := state()
+	if failed.Error == "" || !failed.Last.Equal(before.Last) || !failed.LastFull.Equal(before.LastFull) {
+		t.Errorf("query state after failed search = %+v, want an error and Last unchanged from %v", failed, before.Last)
+	}
+
+	if err := d.search(); err != nil {
+		t.Fatal(err)
+	}
+	after := state()
+	if after.Error != "" || !after.Last.After(before.Last) {
+		t.Errorf("query state after repeated search = %+v, want Last after %v", after, before.Last)
+	}
+}
+
+func TestDaemon_crawl(t *testing.T) {
+	store := storagetest.NewStore(t)
+
+	root := pawn.Package{
+		Package: pawnpackage.Package{
+			DependencyMeta: versioning.DependencyMeta{Site: "github.com", User: "test", Repo: "root"},
+		},
+		Requires: []versioning.DependencyMeta{
+			{Site: "github.com", User: "test", Repo: "b"},
+			{Site: "github.com", User: "test", Repo: "a"},
+		},
+	}
+	if err := store.Set(root); err != nil {
+		t.Fatal(err)
+	}
+
+	d := Daemon{Storer: store, CrawlDepth: 1, CrawlLimit: 1}
+	for _, want := range [][]string{
+		{"github.com/test/a"},
+		{"github.com/test/a", "github.com/test/b"},
+	} {
+		if err := d.crawl(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		marked, err := store.GetMarked()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(marked, want) {
+			t.Errorf("marked after crawl = %v, want %v", marked, want)
+		}
+	}
+}
+
+// hostScraper serves repositories whose names the host spells in a different case than they're
+// looked up with
+type hostScraper struct {
+	names map[string]string // lowercase name to the host's spelling
+}
+
+func (h hostScraper) Scrape(ctx context.Context, name string) (*pawn.Package, error) {
+	canonical, exists, _ := h.Lookup(ctx, name)
+	if !exists {
+		return nil, nil
+	}
+	meta, err := pawn.ParseName(canonical)
+	if err != nil {
+		return nil, err
+	}
+	return &pawn.Package{Package: pawnpackage.Package{DependencyMeta: meta}}, nil
+}
+
+func (h hostScraper) Lookup(ctx context.Context, name string) (string, bool, error) {
+	canonical, ok := h.names[strings.ToLower(name)]
+	return canonical, ok, nil
+}
+
+func TestDaemon_crawlCase(t *testing.T) {
+	store := storagetest.NewStore(t)
+
+	root := pawn.Package{
+		Package: pawnpackage.Package{
+			DependencyMeta: versioning.DependencyMeta{Site: "github.com", User: "test", Repo: "root"},
+		},
+		Requires: []versioning.DependencyMeta{
+			{Site: "github.com", User: "southclaws", Repo: "pawn-errors"},
+		},
+	}
+	if err := store.Set(root); err != nil {
+		t.Fatal(err)
+	}
+
+	d := Daemon{
+		Scraper:    hostScraper{names: map[string]string{"github.com/southclaws/pawn-errors": "github.com/Southclaws/pawn-errors"}},
+		Storer:     store,
+		CrawlDepth: 2,
+	}
+	if err := d.crawl(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	marked, err := store.GetMarked()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"github.com/Southclaws/pawn-errors"}; !reflect.DeepEqual(marked, want) {
+		t.Fatalf("marked after crawl = %v, want %v", marked, want)
+	}
+
+	// once scraped, the dependency is indexed as the package it was marked as and not crawled again
+	d.scrape(context.Background(), marked[0])
+	if err := d.crawl(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	marked, err = store.GetMarked()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(marked) != 0 {
+		t.Errorf("marked after scrape = %v, want none", marked)
+	}
+	discovery, err := store.GetDiscovery("github.com/Southclaws/pawn-errors")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(discovery) != 1 || discovery[0].Source != storage.SourceDependency || discovery[0].RequiredBy != "github.com/test/root" {
+		t.Errorf("discovery = %v, want required by github.com/test/root", discovery)
+	}
+}
+
+func TestDaemon_scrapeRenamed(t *testing.T) {
+	store := storagetest.NewStore(t)
+
+	submission, err := store.Submit("bob/logger")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the repository was renamed after it was submitted, so it's stored under its new name and the
+	// entry it was submitted as is finished with
+	d := Daemon{
+		Scraper: hostScraper{names: map[string]string{"github.com/bob/logger": "github.com/Southclaws/logger"}},
+		Storer:  store,
+	}
+	d.scrape(context.Background(), "github.com/bob/logger")
+
+	if _, exists, err := store.Get("github.com/Southclaws/logger"); err != nil || !exists {
+		t.Errorf("Get() = %v, %v, want the package stored under its new name", exists, err)
+	}
+	if marked, err := store.GetMarked(); err != nil || len(marked) != 0 {
+		t.Errorf("marked = %v, %v, want none", marked, err)
+	}
+	if s, _, err := store.GetSubmission(submission.ID); err != nil || s.Status != storage.SubmissionScraped {
+		t.Errorf("submission = %+v, %v, want scraped", s, err)
+	}
+}
+
+// failingScraper fails to scrape every repository
+type failingScraper struct{}
+
+func (failingScraper) Scrape(ctx context.Context, name string) (*pawn.Package, error) {
+	return nil, errors.New("unavailable")
+}
+
+func TestDaemon_scrapeFailures(t *testing.T) {
+	store := storagetest.NewStore(t)
+
+	submission, err := store.Submit("test/broken")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := Daemon{Scraper: failingScraper{}, Storer: store, RetryBackoff: time.Hour, MaxAttempts: 2}
+
+	// a failed repository isn't scraped again until its backoff has passed
+	d.scrape(context.Background(), "github.com/test/broken")
+	f, exists, err := store.GetFailure("test/broken")
+	if err != nil || !exists {
+		t.Fatalf("GetFailure() = %v, %v, %v", f, exists, err)
+	}
+	if f.Attempts != 1 || f.Error != "unavailable" || f.Dead || f.NextAttempt.Sub(f.Last) != time.Hour {
+		t.Errorf("failure = %+v, want a first attempt retried in an hour", f)
+	}
+	if marked, err := store.GetMarked(); err != nil || len(marked) != 0 {
+		t.Errorf("marked = %v, %v, want the failed repository to wait", marked, err)
+	}
+
+	// after too many failures it's given up on and its submission is rejected
+	d.scrape(context.Background(), "github.com/test/broken")
+	failures, err := store.GetFailures()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failures) != 1 || failures[0].Name != "github.com/test/broken" || failures[0].Attempts != 2 || !failures[0].Dead {
+		t.Errorf("failures = %+v, want a dead repository", failures)
+	}
+	if s, _, err := store.GetSubmission(submission.ID); err != nil || s.Status != storage.SubmissionRejected {
+		t.Errorf("submission = %+v, %v, want rejected", s, err)
+	}
+
+	// submitting it again retries it
+	if _, err := store.Submit("test/broken"); err != nil {
+		t.Fatal(err)
+	}
+	if marked, err := store.GetMarked(); err != nil || !reflect.DeepEqual(marked, []string{"github.com/test/broken"}) {
+		t.Errorf("marked = %v, %v, want the resubmitted repository", marked, err)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		max      time.Duration
+		want     time.Duration
+	}{
+		{1, time.Hour, time.Minute},
+		{2, time.Hour, 2 * time.Minute},
+		{4, time.Hour, 8 * time.Minute},
+		{7, time.Hour, time.Hour},
+		{100, time.Hour, time.Hour},
+		{3, 0, 4 * time.Minute},
+		{1000, 0, math.MaxInt64 / 2},
+	}
+	for _, tt := range tests {
+		if got := backoff(time.Minute, tt.max, tt.attempts); got != tt.want {
+			t.Errorf("backoff(%d, %v) = %v, want %v", tt.attempts, tt.max, got, tt.want)
+		}
+	}
+}
+
+func TestDaemon_refresh(t *testing.T) {
+	store := storagetest.NewStore(t)
+
+	now := time.Now()
+	for _, p := range []pawn.Package{
+		{
+			Package: pawnpackage.Package{DependencyMeta: versioning.DependencyMeta{Site: "github.com", User: "test", Repo: "popular"}},
+			Stars:   1000,
+			Updated: now.Add(-24 * time.Hour),
+		},
+		{
+			Package: pawnpackage.Package{DependencyMeta: versioning.DependencyMeta{Site: "github.com", User: "test", Repo: "dormant"}},
+			Updated: now.Add(-2 * 365 * 24 * time.Hour),
+		},
+	} {
+		if err := store.Set(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	d := Daemon{Storer: store, RefreshMin: 6 * time.Hour, RefreshMax: 720 * time.Hour, RefreshLimit: 1}
+	for _, tt := range []struct {
+		after time.Duration
+		want  []string
+	}{
+		{time.Hour, []string{}},
+		{24 * time.Hour, []string{"github.com/test/popular"}},
+		{31 * 24 * time.Hour, []string{"github.com/test/dormant", "github.com/test/popular"}},
+	} {
+		if err := d.refresh(now.Add(tt.after)); err != nil {
+			t.Fatal(err)
+		}
+		marked, err := store.GetMarked()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(marked, tt.want) {
+			t.Errorf("marked %v after the last scrape = %v, want %v", tt.after, marked, tt.want)
+		}
+	}
+
+	if scraped, err := store.GetScraped("test/popular"); err != nil || scraped.Before(now.Add(-time.Minute)) {
+		t.Errorf("GetScraped() = %v, %v, want the time it was stored", scraped, err)
+	}
+}
+
+func TestDaemon_refreshInterval(t *testing.T) {
+	now := time.Now()
+	d := Daemon{RefreshMin: 12 * time.Hour, RefreshMax: 720 * time.Hour}
+
+	tests := []struct {
+		name    string
+		stars   int
+		updated time.Time
+		want    time.Duration
+	}{
+		{"dormant", 0, now.Add(-2 * 365 * 24 * time.Hour), 720 * time.Hour},
+		{"updated this year", 0, now.Add(-60 * 24 * time.Hour), 360 * time.Hour},
+		{"updated this month", 0, now.Add(-24 * time.Hour), 180 * time.Hour},
+		{"one star", 1, now.Add(-2 * 365 * 24 * time.Hour), 360 * time.Hour},
+		{"popular and active", 100000, now, 12 * time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := d.refreshInterval(storage.ScrapeTime{Stars: tt.stars, Updated: tt.updated}, now)
+			if got != tt.want {
+				t.Errorf("refreshInterval() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
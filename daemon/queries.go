@@ -0,0 +1,69 @@
+package daemon
+
+import (
+	"io/ioutil"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// Query is a discovery query and its schedule
+type Query struct {
+	Query string `yaml:"query"`
+	// Interval is the time between runs of the query, runs happen at most once per SearchInterval
+	// so zero runs it on every search.
+	Interval time.Duration `yaml:"interval"`
+	// FullInterval is the time between full searches of the query, zero uses the
+	// FullSearchInterval of the daemon.
+	FullInterval time.Duration `yaml:"full_interval"`
+	// Code runs the query with code search instead of repository search, code searches can't be
+	// narrowed to recent activity so every run is a full search.
+	Code bool `yaml:"code"`
+}
+
+// DefaultQueries are used when no queries are configured
+var DefaultQueries = []Query{
+	{Query: "topic:pawn-package"},
+	{Query: "language:pawn"},
+	{Query: "topic:sa-mp"},
+	{Query: "topic:open-mp"},
+	{Query: "topic:openmp"},
+	{Query: "filename:pawn.json", Code: true},
+	{Query: "filename:pawn.yaml", Code: true},
+}
+
+// LoadQueries reads discovery queries from a YAML file of the form:
+//
+//	queries:
+//	  - query: topic:pawn-package
+//	  - query: language:pawn stars:>0
+//	    interval: 6h
+//	    full_interval: 168h
+//	  - query: filename:pawn.json
+//	    code: true
+func LoadQueries(path string) ([]Query, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read queries file")
+	}
+
+	var file struct {
+		Queries []Query `yaml:"queries"`
+	}
+	if err := yaml.UnmarshalStrict(contents, &file); err != nil {
+		return nil, errors.Wrap(err, "failed to parse queries file")
+	}
+
+	seen := map[string]bool{}
+	for _, q := range file.Queries {
+		if q.Query == "" {
+			return nil, errors.New("query must not be empty")
+		}
+		if seen[q.Query] {
+			return nil, errors.Errorf("duplicate query %s", q.Query)
+		}
+		seen[q.Query] = true
+	}
+	return file.Queries, nil
+}
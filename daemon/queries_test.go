@@ -0,0 +1,55 @@
+package daemon
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLoadQueries(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		want    []Query
+		wantErr bool
+	}{
+		{"schedules", `
+queries:
+  - query: topic:pawn-package
+  - query: language:pawn stars:>0
+    interval: 6h
+    full_interval: 168h
+`, []Query{
+			{Query: "topic:pawn-package"},
+			{Query: "language:pawn stars:>0", Interval: 6 * time.Hour, FullInterval: 168 * time.Hour},
+		}, false},
+		{"empty query", "queries:\n  - interval: 1h\n", nil, true},
+		{"duplicate", "queries:\n  - query: topic:sa-mp\n  - query: topic:sa-mp\n", nil, true},
+		{"unknown field", "queries:\n  - query: topic:sa-mp\n    schedule: 1h\n", nil, true},
+		{"bad duration", "queries:\n  - query: topic:sa-mp\n    interval: often\n", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := ioutil.TempFile("", "queries*.yaml")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.Remove(f.Name())
+			if _, err := f.WriteString(tt.file); err != nil {
+				t.Fatal(err)
+			}
+			f.Close()
+
+			got, err := LoadQueries(f.Name())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("LoadQueries() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("LoadQueries() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
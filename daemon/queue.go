@@ -0,0 +1,102 @@
+package daemon
+
+import (
+	"context"
+	"sync"
+)
+
+// queue holds the repositories waiting for a scrape worker. A repository is only queued once until
+// a worker has finished scraping it, so scrape ticks that come faster than the workers can keep up
+// don't pile up duplicates. A repository pushed while it's being scraped may have changed after
+// the scrape read it, so it's queued again once the scrape is done.
+type queue struct {
+	mu       sync.Mutex
+	waiting  []string
+	pending  map[string]bool // waiting or being scraped
+	scraping map[string]bool
+	again    map[string]bool // pushed while being scraped, to the front if true
+	ready    chan struct{}
+}
+
+func newQueue() *queue {
+	return &queue{
+		pending:  map[string]bool{},
+		scraping: map[string]bool{},
+		again:    map[string]bool{},
+		ready:    make(chan struct{}, 1),
+	}
+}
+
+// push adds a repository to the back of the queue, or the front if it should be scraped before
+// everything else, unless it's already pending
+func (q *queue) push(name string, front bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.scraping[name] {
+		q.again[name] = q.again[name] || front
+		return
+	}
+	if q.pending[name] {
+		return
+	}
+	q.pending[name] = true
+	if front {
+		q.waiting = append([]string{name}, q.waiting...)
+	} else {
+		q.waiting = append(q.waiting, name)
+	}
+	q.signal()
+}
+
+// pop blocks until a repository is waiting and takes it, ok is false once ctx is done
+func (q *queue) pop(ctx context.Context) (name string, ok bool) {
+	for {
+		q.mu.Lock()
+		if len(q.waiting) > 0 {
+			name, q.waiting = q.waiting[0], q.waiting[1:]
+			q.scraping[name] = true
+			if len(q.waiting) > 0 {
+				q.signal()
+			}
+			q.mu.Unlock()
+			return name, true
+		}
+		q.mu.Unlock()
+
+		select {
+		case <-q.ready:
+		case <-ctx.Done():
+			return "", false
+		}
+	}
+}
+
+// done is called once a popped repository has been scraped, so it can be queued again. If it was
+// pushed while being scraped it's queued again straight away.
+func (q *queue) done(name string) {
+	q.mu.Lock()
+	front, again := q.again[name]
+	delete(q.pending, name)
+	delete(q.scraping, name)
+	delete(q.again, name)
+	q.mu.Unlock()
+
+	if again {
+		q.push(name, front)
+	}
+}
+
+// len returns the number of repositories waiting for a worker
+func (q *queue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.waiting)
+}
+
+// signal wakes a worker waiting in pop, q.mu must be held
+func (q *queue) signal() {
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
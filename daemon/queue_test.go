@@ -0,0 +1,90 @@
+package daemon
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestQueue(t *testing.T) {
+	q := newQueue()
+	q.push("a", false)
+	q.push("b", false)
+	q.push("a", false) // already waiting
+	q.push("c", true)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var got []string
+	for i := 0; i < 3; i++ {
+		r, ok := q.pop(ctx)
+		if !ok {
+			t.Fatal("pop() returned nothing")
+		}
+		got = append(got, r)
+	}
+	if want := []string{"c", "a", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("popped %v, want %v", got, want)
+	}
+
+	// a repository being scraped isn't queued again until it's done, then it's queued again as it
+	// may have changed after the scrape read it
+	q.done("b")
+	q.done("c")
+	q.push("a", false)
+	if q.len() != 0 {
+		t.Errorf("len() = %d, want a pending repository to be skipped", q.len())
+	}
+	q.done("a")
+	if q.len() != 1 {
+		t.Errorf("len() = %d, want a repository pushed while being scraped to be queued again", q.len())
+	}
+	q.pop(ctx)
+	q.push("b", false)
+	q.push("a", true)
+	q.done("a")
+	got = nil
+	for i := 0; i < 2; i++ {
+		r, _ := q.pop(ctx)
+		got = append(got, r)
+		q.done(r)
+	}
+	if want := []string{"a", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("popped %v, want %v", got, want)
+	}
+	q.push("a", false)
+	if q.len() != 1 {
+		t.Errorf("len() = %d, want a finished repository to be queued", q.len())
+	}
+
+	// workers waiting for a repository wake up for new ones and stop with the context
+	popped := make(chan string)
+	go func() {
+		for {
+			r, ok := q.pop(ctx)
+			if !ok {
+				close(popped)
+				return
+			}
+			popped <- r
+		}
+	}()
+	if r := <-popped; r != "a" {
+		t.Errorf("popped %s, want a", r)
+	}
+	q.push("d", false)
+	if r := <-popped; r != "d" {
+		t.Errorf("popped %s, want d", r)
+	}
+	cancel()
+	select {
+	case _, ok := <-popped:
+		if ok {
+			t.Error("pop() returned a repository after the context was done")
+		}
+	case <-time.After(time.Second):
+		t.Error("pop() didn't return after the context was done")
+	}
+}
@@ -0,0 +1,150 @@
+// Package gitea is a minimal client for the parts of the Gitea REST API used to index packages,
+// it also works with Forgejo and hosted instances such as Codeberg.
+package gitea
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Client talks to a single Gitea instance
+type Client struct {
+	BaseURL string       // root of the instance, such as https://codeberg.org
+	Token   string       // optional access token for private repositories and higher rate limits
+	HTTP    *http.Client // defaults to a client with a short timeout
+}
+
+// Repository is a repository as returned by the Gitea API
+type Repository struct {
+	Name  string `json:"name"`
+	Owner struct {
+		Login string `json:"login"`
+	} `json:"owner"`
+	Description   string    `json:"description"`
+	Stars         int       `json:"stars_count"`
+	Updated       time.Time `json:"updated_at"`
+	DefaultBranch string    `json:"default_branch"`
+	Archived      bool      `json:"archived"`
+}
+
+// Branch is a branch and the commit at its head
+type Branch struct {
+	Name   string `json:"name"`
+	Commit struct {
+		ID string `json:"id"`
+	} `json:"commit"`
+}
+
+// Tag is a tag and the commit it points to
+type Tag struct {
+	Name   string `json:"name"`
+	Commit struct {
+		SHA string `json:"sha"`
+	} `json:"commit"`
+}
+
+// Tree is a page of a recursive git tree listing
+type Tree struct {
+	SHA     string      `json:"sha"`
+	Entries []TreeEntry `json:"tree"`
+	Page    int         `json:"page"`
+	Total   int         `json:"total_count"`
+	// Truncated is set when there are more pages of entries
+	Truncated bool `json:"truncated"`
+}
+
+// TreeEntry is a single file or directory in a git tree
+type TreeEntry struct {
+	Path string `json:"path"`
+	Type string `json:"type"`
+	SHA  string `json:"sha"`
+}
+
+// SearchResults is a page of repository search results
+type SearchResults struct {
+	OK   bool         `json:"ok"`
+	Data []Repository `json:"data"`
+}
+
+// Site returns the host name of the instance, which packages hosted on it are named with
+func (c *Client) Site() string {
+	u, err := url.Parse(c.BaseURL)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
+
+// Get requests an API path, relative to /api/v1, and decodes the JSON response into v. If the
+// resource doesn't exist, found is false and v is untouched.
+func (c *Client) Get(ctx context.Context, path string, query url.Values, v interface{}) (found bool, err error) {
+	body, found, err := c.do(ctx, path, query)
+	if err != nil || !found {
+		return found, err
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return false, errors.Wrapf(err, "failed to decode response from %s", path)
+	}
+	return true, nil
+}
+
+// Raw downloads a file from a repository at the given ref
+func (c *Client) Raw(ctx context.Context, owner, repo, ref, path string) (contents []byte, found bool, err error) {
+	return c.do(ctx,
+		fmt.Sprintf("/repos/%s/%s/raw/%s", url.PathEscape(owner), url.PathEscape(repo), escapePath(path)),
+		url.Values{"ref": []string{ref}})
+}
+
+func (c *Client) do(ctx context.Context, path string, query url.Values) (body []byte, found bool, err error) {
+	u := strings.TrimSuffix(c.BaseURL, "/") + "/api/v1" + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "token "+c.Token)
+	}
+
+	client := c.HTTP
+	if client == nil {
+		client = &http.Client{Timeout: time.Second * 10}
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, false, errors.Errorf("unexpected status %s from %s", resp.Status, path)
+	}
+
+	body, err = ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, false, err
+	}
+	return body, true, nil
+}
+
+func escapePath(path string) string {
+	parts := strings.Split(path, "/")
+	for i, p := range parts {
+		parts[i] = url.PathEscape(p)
+	}
+	return strings.Join(parts, "/")
+}
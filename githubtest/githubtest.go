@@ -0,0 +1,576 @@
+// Package githubtest provides an in-process fake of the GitHub REST API endpoints used by pawndex,
+// along with raw.githubusercontent.com, so scrapers and searchers can be tested without a token.
+package githubtest
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	pathpkg "path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// maxSearchResults is the number of results GitHub makes available for a single search query, any
+// more are reported in the total count but can't be paged to.
+const maxSearchResults = 1000
+
+// Repository is a repository served by the fake
+type Repository struct {
+	Owner         string
+	Name          string
+	Description   string
+	Stars         int
+	Language      string
+	Topics        []string
+	Created       time.Time
+	Updated       time.Time
+	Pushed        time.Time
+	Archived      bool
+	DefaultBranch string            // defaults to master
+	Files         map[string]string // path to contents at the head of the default branch
+	Tags          []Tag
+}
+
+// Tag is a tagged commit of a Repository, each tag is its own commit with its own files
+type Tag struct {
+	Name  string
+	Files map[string]string
+}
+
+// FullName returns the owner/name form of the repository name
+func (r Repository) FullName() string {
+	return r.Owner + "/" + r.Name
+}
+
+// HeadSHA returns the commit SHA of the head of the default branch, which changes with its files
+func (r Repository) HeadSHA() string {
+	paths := make([]string, 0, len(r.Files))
+	for path := range r.Files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	head := r.FullName() + "@HEAD"
+	for _, path := range paths {
+		head += "\x00" + path + "\x00" + r.Files[path]
+	}
+	return fakeSHA(head)
+}
+
+// TagSHA returns the commit SHA a tag points to
+func (r Repository) TagSHA(name string) string {
+	return fakeSHA(r.FullName() + "@" + name)
+}
+
+func (r Repository) branch() string {
+	if r.DefaultBranch == "" {
+		return "master"
+	}
+	return r.DefaultBranch
+}
+
+// files returns the files of a commit, ref may be the default branch, a tag name or a commit SHA
+func (r Repository) files(ref string) (map[string]string, bool) {
+	if ref == r.branch() || ref == r.HeadSHA() {
+		return r.Files, true
+	}
+	for _, t := range r.Tags {
+		if ref == t.Name || ref == r.TagSHA(t.Name) {
+			return t.Files, true
+		}
+	}
+	return nil, false
+}
+
+func fakeSHA(s string) string {
+	sum := sha1.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// Server is a running fake GitHub, close it when finished
+type Server struct {
+	*httptest.Server
+
+	mu    sync.Mutex
+	repos map[string]Repository // keyed by lowercase full name, as GitHub is case insensitive
+
+	requests    int // requests served
+	notModified int // conditional requests answered with 304 Not Modified
+	failures    int // requests left to answer with 500 Internal Server Error
+}
+
+// NewServer starts a fake GitHub serving the given repositories
+func NewServer(repos ...Repository) *Server {
+	s := &Server{repos: map[string]Repository{}}
+	for _, r := range repos {
+		s.SetRepository(r)
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.conditional))
+	return s
+}
+
+// Requests returns the number of requests served and how many of them were conditional requests
+// answered with 304 Not Modified, which don't count towards GitHub's rate limit
+func (s *Server) Requests() (total, notModified int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests, s.notModified
+}
+
+// Fail makes the next n requests fail with 500 Internal Server Error
+func (s *Server) Fail(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = n
+}
+
+// conditional serves a request with an ETag of the response body, like GitHub, answering with 304
+// Not Modified if the request's If-None-Match matches it
+func (s *Server) conditional(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	fail := s.failures > 0
+	if fail {
+		s.failures--
+		s.requests++
+	}
+	s.mu.Unlock()
+	if fail {
+		http.Error(w, `{"message":"Server Error"}`, http.StatusInternalServerError)
+		return
+	}
+
+	rec := httptest.NewRecorder()
+	s.handle(rec, r)
+
+	sum := sha1.Sum(rec.Body.Bytes())
+	etag := `"` + hex.EncodeToString(sum[:]) + `"`
+	notModified := rec.Code == http.StatusOK && r.Header.Get("If-None-Match") == etag
+
+	s.mu.Lock()
+	s.requests++
+	if notModified {
+		s.notModified++
+	}
+	s.mu.Unlock()
+
+	for k, v := range rec.Header() {
+		w.Header()[k] = v
+	}
+	if rec.Code == http.StatusOK {
+		w.Header().Set("ETag", etag)
+	}
+	if notModified {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.WriteHeader(rec.Code)
+	w.Write(rec.Body.Bytes())
+}
+
+// SetRepository adds a repository or replaces one with the same name
+func (s *Server) SetRepository(r Repository) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.repos[strings.ToLower(r.FullName())] = r
+}
+
+// GitHub returns a client for the fake API
+func (s *Server) GitHub() *github.Client {
+	client, _ := github.NewEnterpriseClient(s.APIURL(), s.URL+"/uploads/", s.Server.Client())
+	return client
+}
+
+// APIURL returns the base URL of the REST API, in place of https://api.github.com/
+func (s *Server) APIURL() string {
+	return s.URL + "/"
+}
+
+// RawURL returns the base URL raw file contents are served from, in place of
+// https://raw.githubusercontent.com/
+func (s *Server) RawURL() string {
+	return s.URL + "/raw/"
+}
+
+func (s *Server) repo(owner, name string) (Repository, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.repos[strings.ToLower(owner+"/"+name)]
+	return r, ok
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+
+	switch {
+	case len(parts) >= 5 && parts[0] == "raw":
+		s.raw(w, r, parts[1], parts[2], parts[3], strings.Join(parts[4:], "/"))
+	case len(parts) == 2 && parts[0] == "search" && parts[1] == "repositories":
+		s.search(w, r)
+	case len(parts) == 2 && parts[0] == "search" && parts[1] == "code":
+		s.searchCode(w, r)
+	case len(parts) >= 3 && parts[0] == "repos":
+		repo, ok := s.repo(parts[1], parts[2])
+		if !ok {
+			notFound(w)
+			return
+		}
+		s.repository(w, r, repo, parts[3:])
+	default:
+		notFound(w)
+	}
+}
+
+func (s *Server) repository(w http.ResponseWriter, r *http.Request, repo Repository, parts []string) {
+	switch {
+	case len(parts) == 0:
+		writeJSON(w, repoJSON(repo))
+
+	case len(parts) == 1 && parts[0] == "tags":
+		var tags []interface{}
+		for _, t := range repo.Tags {
+			tags = append(tags, map[string]interface{}{
+				"name":   t.Name,
+				"commit": map[string]string{"sha": repo.TagSHA(t.Name)},
+			})
+		}
+		writePage(w, r, tags, len(tags), func(items []interface{}, total int) interface{} { return items })
+
+	case len(parts) == 4 && parts[0] == "git" && parts[1] == "refs" && parts[2] == "heads":
+		if parts[3] != repo.branch() {
+			notFound(w)
+			return
+		}
+		writeJSON(w, map[string]interface{}{
+			"ref":    "refs/heads/" + parts[3],
+			"object": map[string]string{"type": "commit", "sha": repo.HeadSHA()},
+		})
+
+	case len(parts) == 3 && parts[0] == "git" && parts[1] == "trees":
+		files, ok := repo.files(parts[2])
+		if !ok {
+			notFound(w)
+			return
+		}
+		var paths []string
+		for path := range files {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+		var entries []interface{}
+		for _, path := range paths {
+			entries = append(entries, map[string]string{"path": path, "mode": "100644", "type": "blob"})
+		}
+		writeJSON(w, map[string]interface{}{"sha": parts[2], "tree": entries, "truncated": false})
+
+	case len(parts) >= 2 && parts[0] == "contents":
+		ref := r.URL.Query().Get("ref")
+		if ref == "" {
+			ref = repo.branch()
+		}
+		files, ok := repo.files(ref)
+		if !ok {
+			notFound(w)
+			return
+		}
+		path := strings.Join(parts[1:], "/")
+		contents, ok := files[path]
+		if !ok {
+			notFound(w)
+			return
+		}
+		writeJSON(w, map[string]interface{}{
+			"type":     "file",
+			"encoding": "base64",
+			"name":     parts[len(parts)-1],
+			"path":     path,
+			"size":     len(contents),
+			"content":  base64.StdEncoding.EncodeToString([]byte(contents)),
+		})
+
+	default:
+		notFound(w)
+	}
+}
+
+func (s *Server) raw(w http.ResponseWriter, r *http.Request, owner, name, ref, path string) {
+	repo, ok := s.repo(owner, name)
+	if !ok {
+		notFound(w)
+		return
+	}
+	files, ok := repo.files(ref)
+	if !ok {
+		notFound(w)
+		return
+	}
+	contents, ok := files[path]
+	if !ok {
+		notFound(w)
+		return
+	}
+	w.Write([]byte(contents))
+}
+
+// search matches repositories against the qualifiers of a search query. Topic, language, created,
+// pushed and stars qualifiers are supported, other qualifiers are ignored and any remaining
+// keywords must appear in the name or description.
+func (s *Server) search(w http.ResponseWriter, r *http.Request) {
+	terms := strings.Fields(r.URL.Query().Get("q"))
+
+	s.mu.Lock()
+	var matches []Repository
+	for _, repo := range s.repos {
+		if matchesQuery(repo, terms) {
+			matches = append(matches, repo)
+		}
+	}
+	s.mu.Unlock()
+
+	sort.Slice(matches, func(i, j int) bool {
+		return strings.ToLower(matches[i].FullName()) < strings.ToLower(matches[j].FullName())
+	})
+
+	total := len(matches)
+	if len(matches) > maxSearchResults {
+		matches = matches[:maxSearchResults]
+	}
+	var items []interface{}
+	for _, repo := range matches {
+		items = append(items, repoJSON(repo))
+	}
+	writePage(w, r, items, total, func(items []interface{}, total int) interface{} {
+		return map[string]interface{}{
+			"total_count":        total,
+			"incomplete_results": false,
+			"items":              items,
+		}
+	})
+}
+
+// searchCode matches the files at the head of each repository against the filename qualifier of a
+// code search query, the other terms are matched against the repository like a repository search.
+func (s *Server) searchCode(w http.ResponseWriter, r *http.Request) {
+	var filename string
+	var terms []string
+	for _, term := range strings.Fields(r.URL.Query().Get("q")) {
+		if strings.HasPrefix(term, "filename:") {
+			filename = strings.TrimPrefix(term, "filename:")
+			continue
+		}
+		terms = append(terms, term)
+	}
+
+	type match struct {
+		repo Repository
+		path string
+	}
+	s.mu.Lock()
+	var matches []match
+	for _, repo := range s.repos {
+		if !matchesQuery(repo, terms) {
+			continue
+		}
+		for path := range repo.Files {
+			if filename == "" || pathpkg.Base(path) == filename {
+				matches = append(matches, match{repo, path})
+			}
+		}
+	}
+	s.mu.Unlock()
+
+	sort.Slice(matches, func(i, j int) bool {
+		a, b := strings.ToLower(matches[i].repo.FullName()), strings.ToLower(matches[j].repo.FullName())
+		if a != b {
+			return a < b
+		}
+		return matches[i].path < matches[j].path
+	})
+
+	total := len(matches)
+	if len(matches) > maxSearchResults {
+		matches = matches[:maxSearchResults]
+	}
+	var items []interface{}
+	for _, m := range matches {
+		items = append(items, map[string]interface{}{
+			"name":       pathpkg.Base(m.path),
+			"path":       m.path,
+			"sha":        fakeSHA(m.repo.FullName() + "/" + m.path),
+			"repository": repoJSON(m.repo),
+		})
+	}
+	writePage(w, r, items, total, func(items []interface{}, total int) interface{} {
+		return map[string]interface{}{
+			"total_count":        total,
+			"incomplete_results": false,
+			"items":              items,
+		}
+	})
+}
+
+func matchesQuery(repo Repository, terms []string) bool {
+	for _, term := range terms {
+		if i := strings.Index(term, ":"); i != -1 {
+			qualifier, value := term[:i], term[i+1:]
+			switch qualifier {
+			case "topic":
+				found := false
+				for _, t := range repo.Topics {
+					if strings.EqualFold(t, value) {
+						found = true
+					}
+				}
+				if !found {
+					return false
+				}
+			case "language":
+				if !strings.EqualFold(repo.Language, value) {
+					return false
+				}
+			case "created":
+				if !matchesRange(value, repo.Created.Unix(), parseTimeBound) {
+					return false
+				}
+			case "pushed":
+				if !matchesRange(value, repo.Pushed.Unix(), parseTimeBound) {
+					return false
+				}
+			case "stars":
+				if !matchesRange(value, int64(repo.Stars), parseIntBound) {
+					return false
+				}
+			}
+			continue
+		}
+		term = strings.ToLower(term)
+		if !strings.Contains(strings.ToLower(repo.Name), term) &&
+			!strings.Contains(strings.ToLower(repo.Description), term) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesRange checks a value against a range qualifier such as `10..20`, `>=10`, `<10` or `10`.
+// The bound parser returns the first and last values a bound covers, a date covers a whole day.
+func matchesRange(expr string, v int64, parse func(string) (first, last int64, ok bool)) bool {
+	if i := strings.Index(expr, ".."); i != -1 {
+		lo, _, ok1 := parse(expr[:i])
+		_, hi, ok2 := parse(expr[i+2:])
+		return ok1 && ok2 && v >= lo && v <= hi
+	}
+	for _, op := range []string{">=", "<=", ">", "<"} {
+		if !strings.HasPrefix(expr, op) {
+			continue
+		}
+		first, last, ok := parse(strings.TrimPrefix(expr, op))
+		if !ok {
+			return false
+		}
+		switch op {
+		case ">=":
+			return v >= first
+		case "<=":
+			return v <= last
+		case ">":
+			return v > last
+		default:
+			return v < first
+		}
+	}
+	first, last, ok := parse(expr)
+	return ok && v >= first && v <= last
+}
+
+func parseTimeBound(s string) (first, last int64, ok bool) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t.Unix(), t.Unix(), true
+	}
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t.Unix(), t.Add(24*time.Hour).Unix() - 1, true
+	}
+	return 0, 0, false
+}
+
+func parseIntBound(s string) (first, last int64, ok bool) {
+	n, err := strconv.ParseInt(s, 10, 64)
+	return n, n, err == nil
+}
+
+func repoJSON(repo Repository) map[string]interface{} {
+	topics := repo.Topics
+	if topics == nil {
+		topics = []string{}
+	}
+	return map[string]interface{}{
+		"name":             repo.Name,
+		"full_name":        repo.FullName(),
+		"owner":            map[string]string{"login": repo.Owner},
+		"description":      repo.Description,
+		"stargazers_count": repo.Stars,
+		"language":         repo.Language,
+		"topics":           topics,
+		"default_branch":   repo.branch(),
+		"created_at":       repo.Created.Format(time.RFC3339),
+		"updated_at":       repo.Updated.Format(time.RFC3339),
+		"pushed_at":        repo.Pushed.Format(time.RFC3339),
+		"archived":         repo.Archived,
+	}
+}
+
+// writePage writes one page of items, selected by the page and per_page parameters, with a Link
+// header pointing to the next page if there is one
+func writePage(w http.ResponseWriter, r *http.Request, items []interface{}, total int, wrap func([]interface{}, int) interface{}) {
+	query := r.URL.Query()
+	page, _ := strconv.Atoi(query.Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	perPage, _ := strconv.Atoi(query.Get("per_page"))
+	if perPage < 1 {
+		perPage = 30
+	} else if perPage > 100 {
+		perPage = 100
+	}
+
+	start, end := (page-1)*perPage, page*perPage
+	if start > len(items) {
+		start = len(items)
+	}
+	if end > len(items) {
+		end = len(items)
+	}
+
+	if end < len(items) {
+		query.Set("page", strconv.Itoa(page+1))
+		next := url.URL{Scheme: "http", Host: r.Host, Path: r.URL.Path, RawQuery: query.Encode()}
+		w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="next"`, next.String()))
+	}
+
+	items = items[start:end]
+	if items == nil {
+		items = []interface{}{}
+	}
+	writeJSON(w, wrap(items, total))
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func notFound(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusNotFound)
+	w.Write([]byte(`{"message":"Not Found"}`))
+}
@@ -6,6 +6,7 @@ require (
 	github.com/Masterminds/semver v1.5.0
 	github.com/Southclaws/sampctl v0.0.0-20200720202434-1e56fc329606
 	github.com/go-chi/chi v4.1.1+incompatible
+	github.com/go-git/go-git/v5 v5.0.0
 	github.com/google/go-github v17.0.0+incompatible
 	github.com/gorilla/handlers v1.4.0
 	github.com/joho/godotenv v1.3.0
@@ -0,0 +1,178 @@
+// Package httpcache caches GitHub API responses so repeated requests are made conditionally, with
+// the ETag or Last-Modified date of the cached response. GitHub answers those with 304 Not
+// Modified when nothing has changed, which doesn't count towards the rate limit.
+package httpcache
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// Store persists cached responses, storage.DB implements it
+type Store interface {
+	GetResponse(key string) ([]byte, bool, error)
+	SetResponse(key string, raw []byte) error
+}
+
+var (
+	// treePath matches the path of a git tree looked up by its SHA, which can never change
+	treePath = regexp.MustCompile(`/git/trees/[0-9a-f]{40}$`)
+	// contentsPath matches the path of a file read through the contents API
+	contentsPath = regexp.MustCompile(`/repos/[^/]+/[^/]+/contents/`)
+	// commitSHA matches a full commit SHA, files read at one can never change
+	commitSHA = regexp.MustCompile(`^[0-9a-f]{40}$`)
+)
+
+// Transport makes GET requests conditional on the cached response to the same URL changing.
+// Trees looked up by SHA and files read at a commit SHA are served from the cache without a
+// request at all, so an unchanged default branch only costs the request for its ref. Search
+// results are never cached, the queries change from one search to the next.
+type Transport struct {
+	Store Store
+	Base  http.RoundTripper // defaults to http.DefaultTransport
+}
+
+// entry is a cached response
+type entry struct {
+	URL    string      `json:"url"`
+	Header http.Header `json:"header"`
+	Body   []byte      `json:"body"`
+}
+
+func (t *Transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if r.Method != http.MethodGet || r.Header.Get("Range") != "" || strings.Contains(r.URL.Path, "/search/") {
+		return base.RoundTrip(r)
+	}
+
+	key := cacheKey(r)
+	cached, ok := t.load(key)
+	if ok && cached.URL != r.URL.String() {
+		ok = false // a different commit of the same repository
+	}
+	immutable := atCommit(r)
+	if ok && immutable {
+		return cached.response(r), nil
+	}
+
+	conditional := r
+	if ok {
+		conditional = r.Clone(r.Context())
+		if etag := cached.Header.Get("ETag"); etag != "" {
+			conditional.Header.Set("If-None-Match", etag)
+		}
+		if modified := cached.Header.Get("Last-Modified"); modified != "" {
+			conditional.Header.Set("If-Modified-Since", modified)
+		}
+	}
+
+	resp, err := base.RoundTrip(conditional)
+	if err != nil {
+		return nil, err
+	}
+
+	if ok && resp.StatusCode == http.StatusNotModified {
+		resp.Body.Close()
+		cachedResp := cached.response(r)
+		// the rate limit has moved on since the response was cached
+		for k, v := range resp.Header {
+			if strings.HasPrefix(k, "X-Ratelimit-") {
+				cachedResp.Header[k] = v
+			}
+		}
+		return cachedResp, nil
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return resp, nil
+	}
+	if !immutable && resp.Header.Get("ETag") == "" && resp.Header.Get("Last-Modified") == "" {
+		return resp, nil
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	t.save(key, entry{URL: r.URL.String(), Header: resp.Header, Body: body})
+
+	return resp, nil
+}
+
+// atCommit reports whether a request is for a tree or file at a commit SHA, whose response can never
+// change
+func atCommit(r *http.Request) bool {
+	return treePath.MatchString(r.URL.Path) ||
+		contentsPath.MatchString(r.URL.Path) && commitSHA.MatchString(r.URL.Query().Get("ref"))
+}
+
+// cacheKey identifies the cached response to a request. Trees share a key per repository, and
+// files read at a commit SHA share a key per repository and path, with the SHA checked against the
+// cached URL. So the cache holds one tree and one copy of each file per repository rather than one
+// for every commit ever scraped.
+func cacheKey(r *http.Request) string {
+	u := *r.URL
+	switch {
+	case treePath.MatchString(u.Path):
+		u.Path = u.Path[:strings.LastIndex(u.Path, "/")]
+	case atCommit(r):
+		q := u.Query()
+		q.Set("ref", "commit")
+		u.RawQuery = q.Encode()
+	}
+	// the Accept header selects previews that change the response body
+	return u.String() + " " + r.Header.Get("Accept")
+}
+
+func (t *Transport) load(key string) (e entry, ok bool) {
+	raw, ok, err := t.Store.GetResponse(key)
+	if err != nil {
+		zap.L().Error("failed to read cached response", zap.String("key", key), zap.Error(err))
+		return e, false
+	}
+	if !ok {
+		return e, false
+	}
+	if err := json.Unmarshal(raw, &e); err != nil {
+		zap.L().Error("failed to decode cached response", zap.String("key", key), zap.Error(err))
+		return e, false
+	}
+	return e, true
+}
+
+func (t *Transport) save(key string, e entry) {
+	raw, err := json.Marshal(e)
+	if err != nil {
+		zap.L().Error("failed to encode response", zap.String("key", key), zap.Error(err))
+		return
+	}
+	if err := t.Store.SetResponse(key, raw); err != nil {
+		zap.L().Error("failed to cache response", zap.String("key", key), zap.Error(err))
+	}
+}
+
+// response builds a response to r from the cached one
+func (e entry) response(r *http.Request) *http.Response {
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        e.Header.Clone(),
+		Body:          ioutil.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       r,
+	}
+}
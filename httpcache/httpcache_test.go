@@ -0,0 +1,126 @@
+package httpcache_test
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/google/go-github/github"
+
+	"github.com/Southclaws/pawndex/githubtest"
+	"github.com/Southclaws/pawndex/httpcache"
+	"github.com/Southclaws/pawndex/scraper"
+)
+
+// memoryStore caches responses in a map
+type memoryStore struct {
+	mu        sync.Mutex
+	responses map[string][]byte
+}
+
+func (m *memoryStore) GetResponse(key string) ([]byte, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	raw, ok := m.responses[key]
+	return raw, ok, nil
+}
+
+func (m *memoryStore) SetResponse(key string, raw []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.responses[key] = raw
+	return nil
+}
+
+// memoryIndex holds the commits of the last scrape, as storage would after indexing it
+type memoryIndex struct {
+	commits map[string]string
+}
+
+func (m *memoryIndex) GetIndexedCommits(name string) (map[string]string, error) {
+	return m.commits, nil
+}
+
+func TestTransport(t *testing.T) {
+	repo := githubtest.Repository{
+		Owner: "Southclaws", Name: "samp-logger",
+		Files: map[string]string{
+			"pawn.json":  `{"user":"Southclaws","repo":"samp-logger"}`,
+			"logger.inc": "stock Logger_Log(const text[]) {}\n",
+		},
+		Tags: []githubtest.Tag{{Name: "1.0.0", Files: map[string]string{"pawn.json": `{"user":"Southclaws","repo":"samp-logger"}`}}},
+	}
+	server := githubtest.NewServer(repo)
+	defer server.Close()
+
+	store := &memoryStore{responses: map[string][]byte{}}
+	client := &http.Client{Transport: &httpcache.Transport{Store: store, Base: server.Client().Transport}}
+	gh, err := github.NewEnterpriseClient(server.APIURL(), server.URL+"/uploads/", client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	index := &memoryIndex{}
+	s := scraper.GitHubScraper{GitHub: gh, Index: index}
+
+	first, err := s.Scrape(context.Background(), "Southclaws/samp-logger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	requests, notModified := server.Requests()
+	if notModified != 0 {
+		t.Errorf("first scrape had %d requests not modified, want none cached yet", notModified)
+	}
+	index.commits = first.Commits
+
+	// nothing has changed so the include at the head and the tag aren't read again, and the rest is
+	// answered from the cache. Only the head's tree is requested, the tag's tree replaced it.
+	second, err := s.Scrape(context.Background(), "Southclaws/samp-logger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(second.Commits, first.Commits) || second.Symbols != nil || second.Versions != nil {
+		t.Errorf("second scrape read %v again, want %v kept as indexed", second.Commits, first.Commits)
+	}
+	const atCommit = 3 // the tag's tree, the include at the head and the definition at the tag
+	total, notModified := server.Requests()
+	if want := requests - atCommit; total-requests != want || notModified != want-1 {
+		t.Errorf("second scrape made %d requests with %d not modified, want %d with all but the tree not modified",
+			total-requests, notModified, want)
+	}
+	index.commits = second.Commits
+	cached := len(store.responses)
+
+	// a new commit changes the tree
+	repo.Files = map[string]string{
+		"pawn.json":  repo.Files["pawn.json"],
+		"logger.inc": repo.Files["logger.inc"],
+		"extra.inc":  "native Extra();\n",
+	}
+	server.SetRepository(repo)
+	third, err := s.Scrape(context.Background(), "Southclaws/samp-logger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"extra.inc", "logger.inc"}; !reflect.DeepEqual(third.Includes, want) {
+		t.Errorf("third scrape includes = %v, want %v", third.Includes, want)
+	}
+	// the tree and include of the new commit replace those of the old one, only the new include adds
+	// to the cache
+	if len(store.responses) != cached+1 {
+		t.Errorf("cached %d responses after third scrape, want %d", len(store.responses), cached+1)
+	}
+	index.commits = third.Commits
+
+	// with the new head's tree cached every request is not modified
+	requests, notModified = server.Requests()
+	if _, err := s.Scrape(context.Background(), "Southclaws/samp-logger"); err != nil {
+		t.Fatal(err)
+	}
+	total, nowNotModified := server.Requests()
+	if total-requests != nowNotModified-notModified {
+		t.Errorf("fourth scrape made %d requests with %d not modified, want all not modified",
+			total-requests, nowNotModified-notModified)
+	}
+}
@@ -0,0 +1,17 @@
+package pawn
+
+// ConflictKind is the reason two or more packages can't be used together
+type ConflictKind string
+
+var (
+	ConflictInclude ConflictKind = "include" // the packages ship include files with the same name
+	ConflictGuard   ConflictKind = "guard"   // the packages define the same include guard
+)
+
+// Conflict describes an include file name or include guard that is shared by multiple packages,
+// including more than one of these packages in a project will cause one to shadow the other.
+type Conflict struct {
+	Kind     ConflictKind `json:"kind"`
+	Name     string       `json:"name"`
+	Packages []string     `json:"packages"`
+}
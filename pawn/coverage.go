@@ -0,0 +1,24 @@
+package pawn
+
+import "time"
+
+// SearchCoverage describes how much of a search query's results were retrieved. Hosts limit how
+// many results a single query returns, GitHub stops at 1000, so large queries are split into slices
+// and any slice still over the limit is truncated.
+type SearchCoverage struct {
+	Site      string    `json:"site"`
+	Query     string    `json:"query"`
+	Pushed    string    `json:"pushed,omitempty"` // activity window of an incremental search, such as >2020-01-01
+	Total     int       `json:"total"`            // results reported for the whole query
+	Found     int       `json:"found"`            // unique repositories retrieved
+	Slices    int       `json:"slices"`           // number of narrower queries the search was split into
+	Truncated int       `json:"truncated"`        // slices that were still over the limit
+	Missed    int       `json:"missed"`           // results in truncated slices that couldn't be retrieved
+	Failed    int       `json:"failed"`           // slices that failed with an error
+	Time      time.Time `json:"time"`
+}
+
+// Complete returns true if every result of the query was retrieved
+func (c SearchCoverage) Complete() bool {
+	return c.Truncated == 0 && c.Failed == 0
+}
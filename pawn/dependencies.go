@@ -0,0 +1,20 @@
+package pawn
+
+import (
+	"github.com/Southclaws/sampctl/versioning"
+	"go.uber.org/zap"
+)
+
+// ParseDependencies explodes a list of dependency strings, invalid ones are skipped.
+func ParseDependencies(deps []versioning.DependencyString) (metas []versioning.DependencyMeta) {
+	for _, d := range deps {
+		meta, err := d.Explode()
+		if err != nil {
+			zap.L().Debug("skipping invalid dependency string",
+				zap.String("dependency", string(d)), zap.Error(err))
+			continue
+		}
+		metas = append(metas, meta)
+	}
+	return
+}
@@ -0,0 +1,64 @@
+package pawn
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/Southclaws/sampctl/versioning"
+	"github.com/pkg/errors"
+)
+
+// DefaultSite is the host assumed for packages that are named without one
+const DefaultSite = "github.com"
+
+// Name builds the canonical name of a package, which includes the host it lives on so packages
+// with the same user and repo on different hosts don't collide.
+func Name(site, user, repo string) string {
+	if site == "" {
+		site = DefaultSite
+	}
+	return fmt.Sprintf("%s/%s/%s", site, user, repo)
+}
+
+// ParseName splits a package name of the form host/user/repo, or user/repo which is assumed to
+// live on the default site.
+func ParseName(name string) (meta versioning.DependencyMeta, err error) {
+	parts := strings.Split(strings.Trim(name, "/"), "/")
+	switch len(parts) {
+	case 2:
+		meta = versioning.DependencyMeta{Site: DefaultSite, User: parts[0], Repo: parts[1]}
+	case 3:
+		meta = versioning.DependencyMeta{Site: parts[0], User: parts[1], Repo: parts[2]}
+	default:
+		return meta, errors.Errorf("invalid package name '%s'", name)
+	}
+	if meta.Site == "" || meta.User == "" || meta.Repo == "" {
+		return meta, errors.Errorf("invalid package name '%s'", name)
+	}
+	return meta, nil
+}
+
+// CanonicalName adds the default site to a package name if it doesn't specify one, names that
+// can't be parsed are returned unchanged.
+func CanonicalName(name string) string {
+	meta, err := ParseName(name)
+	if err != nil {
+		return name
+	}
+	return Name(meta.Site, meta.User, meta.Repo)
+}
+
+// ParseLocation parses a package name or the URL of a repository such as
+// https://github.com/user/repo, any path after the repository is ignored.
+func ParseLocation(location string) (meta versioning.DependencyMeta, err error) {
+	location = strings.TrimSpace(location)
+	if u, err := url.Parse(location); err == nil && u.Host != "" {
+		parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+		if len(parts) < 2 {
+			return meta, errors.Errorf("invalid repository URL '%s'", location)
+		}
+		location = Name(u.Host, parts[0], strings.TrimSuffix(parts[1], ".git"))
+	}
+	return ParseName(location)
+}
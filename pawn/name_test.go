@@ -0,0 +1,36 @@
+package pawn
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Southclaws/sampctl/versioning"
+)
+
+func TestParseLocation(t *testing.T) {
+	tests := []struct {
+		location string
+		want     versioning.DependencyMeta
+		wantErr  bool
+	}{
+		{"Southclaws/samp-logger", versioning.DependencyMeta{Site: "github.com", User: "Southclaws", Repo: "samp-logger"}, false},
+		{"codeberg.org/test/lib", versioning.DependencyMeta{Site: "codeberg.org", User: "test", Repo: "lib"}, false},
+		{"https://github.com/Southclaws/samp-logger", versioning.DependencyMeta{Site: "github.com", User: "Southclaws", Repo: "samp-logger"}, false},
+		{"https://github.com/Southclaws/samp-logger.git", versioning.DependencyMeta{Site: "github.com", User: "Southclaws", Repo: "samp-logger"}, false},
+		{" https://github.com/Southclaws/samp-logger/tree/master/src ", versioning.DependencyMeta{Site: "github.com", User: "Southclaws", Repo: "samp-logger"}, false},
+		{"https://github.com/Southclaws", versioning.DependencyMeta{}, true},
+		{"samp-logger", versioning.DependencyMeta{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.location, func(t *testing.T) {
+			got, err := ParseLocation(tt.location)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseLocation() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseLocation() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,10 +1,10 @@
 package pawn
 
 import (
-	"fmt"
 	"time"
 
 	"github.com/Southclaws/sampctl/pawnpackage"
+	"github.com/Southclaws/sampctl/versioning"
 )
 
 // Classification represents how compatible or easy to use a package is. If a package contains a
@@ -22,12 +22,47 @@ var (
 type Package struct {
 	pawnpackage.Package
 	Classification Classification `json:"classification"` // classification represents how conformative the package is
+	Description    string         `json:"description"`    // repository description
 	Stars          int            `json:"stars"`          // GitHub stars
 	Updated        time.Time      `json:"updated"`        // last updated
 	Topics         []string       `json:"topics"`         // GitHub topics
 	Tags           []string       `json:"tags"`           // Git tags
+	Archived       bool           `json:"archived"`       // the repository is read-only
+
+	// Includes lists the path of every .inc file in the repository
+	Includes []string `json:"includes,omitempty"`
+
+	// Requires is the parsed form of the dependencies and development dependencies
+	Requires []versioning.DependencyMeta `json:"requires,omitempty"`
+
+	// Versions holds the package definition declared at each tag, with the Tag and Commit fields
+	// set. These are stored separately from the package so they are omitted from the JSON form.
+	Versions []pawnpackage.Package `json:"-"`
+
+	// Symbols holds the declarations found in the package's include files at each tag and the head
+	// of the default branch, like Versions these are stored separately.
+	Symbols []Symbol `json:"-"`
+
+	// Commits holds the commit each tag was read at, with the default branch under an empty tag.
+	// Tags a scrape didn't read again because they hadn't moved keep the commit they were indexed
+	// at, so their stored versions and symbols are kept.
+	Commits map[string]string `json:"-"`
+}
+
+// Rank orders classifications by how easy the package is to use, higher is better.
+func (c Classification) Rank() int {
+	switch c {
+	case ClassificationPawnPackage:
+		return 3
+	case ClassificationBarebones:
+		return 2
+	case ClassificationBuried:
+		return 1
+	default:
+		return 0
+	}
 }
 
 func (p *Package) String() string {
-	return fmt.Sprintf("%s/%s", p.User, p.Repo)
+	return Name(p.Site, p.User, p.Repo)
 }
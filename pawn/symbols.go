@@ -0,0 +1,161 @@
+package pawn
+
+import (
+	"bufio"
+	"bytes"
+	"regexp"
+	"strings"
+)
+
+// SymbolKind is the type of declaration a symbol was extracted from
+type SymbolKind string
+
+var (
+	SymbolNative     SymbolKind = "native"
+	SymbolForward    SymbolKind = "forward"
+	SymbolStock      SymbolKind = "stock"
+	SymbolPublic     SymbolKind = "public"
+	SymbolDefine     SymbolKind = "define"
+	SymbolEnum       SymbolKind = "enum"
+	SymbolEnumerator SymbolKind = "enumerator"
+	SymbolGuard      SymbolKind = "guard" // an include guard, such as _inc_a_samp
+)
+
+// Symbol is a declaration found in a Pawn include file
+type Symbol struct {
+	Name      string     `json:"name"`
+	Kind      SymbolKind `json:"kind"`
+	Signature string     `json:"signature"` // the declaration as written, without its body
+	Path      string     `json:"path"`      // file the symbol was declared in
+	Line      int        `json:"line"`      // 1-based line number of the declaration
+	Tag       string     `json:"tag"`       // tag the symbol was found at, empty for the default branch
+}
+
+// maxSignature bounds the length of stored signatures, some macros are enormous
+const maxSignature = 256
+
+var (
+	matchFunction   = regexp.MustCompile(`^(?:static\s+)?(native|forward|stock|public)\s+(?:(?:static|const)\s+)*(?:[A-Za-z_@][\w@]*:)?([A-Za-z_@][\w@.]*)\s*\(`)
+	matchDefine     = regexp.MustCompile(`^#\s*define\s+([A-Za-z_@][\w@]*)`)
+	matchIfDefined  = regexp.MustCompile(`^#\s*if\s+!?\s*defined\s*\(?\s*([A-Za-z_@][\w@]*)`)
+	matchEnum       = regexp.MustCompile(`^enum\b\s*(?:(?:[A-Za-z_@][\w@]*:)?([A-Za-z_@][\w@]*))?`)
+	matchEnumerator = regexp.MustCompile(`^(?:[A-Za-z_@][\w@]*:)?([A-Za-z_@][\w@]*)`)
+)
+
+// ParseSymbols extracts the natives, forwards, stocks, publics, macros, include guards and enums
+// declared in the source of a Pawn include file. This is a line based scan rather than a full parse, so unusual
+// formatting may cause declarations to be missed.
+func ParseSymbols(path string, src []byte) (symbols []Symbol) {
+	var (
+		scanner = bufio.NewScanner(bytes.NewReader(stripComments(src)))
+		line    int
+		inEnum  bool
+		tested  = map[string]bool{} // names checked with #if defined, for detecting guards
+	)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	add := func(name string, kind SymbolKind, signature string) {
+		signature = strings.TrimSpace(signature)
+		if len(signature) > maxSignature {
+			signature = signature[:maxSignature]
+		}
+		symbols = append(symbols, Symbol{Name: name, Kind: kind, Signature: signature, Path: path, Line: line})
+	}
+
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		if inEnum {
+			if strings.HasPrefix(text, "}") {
+				inEnum = false
+				continue
+			}
+			for _, e := range strings.Split(text, ",") {
+				if m := matchEnumerator.FindStringSubmatch(strings.TrimSpace(e)); m != nil {
+					add(m[1], SymbolEnumerator, strings.TrimSpace(e))
+				}
+			}
+			continue
+		}
+
+		if m := matchFunction.FindStringSubmatch(text); m != nil {
+			add(m[2], SymbolKind(m[1]), declaration(text))
+		} else if m := matchIfDefined.FindStringSubmatch(text); m != nil {
+			tested[m[1]] = true
+		} else if m := matchDefine.FindStringSubmatch(text); m != nil {
+			// a valueless macro that was checked before being defined guards the file
+			if tested[m[1]] && strings.TrimSpace(text[len(m[0]):]) == "" {
+				add(m[1], SymbolGuard, text)
+			} else {
+				add(m[1], SymbolDefine, text)
+			}
+		} else if m := matchEnum.FindStringSubmatch(text); m != nil {
+			// anonymous enums only declare their enumerators
+			if m[1] != "" {
+				add(m[1], SymbolEnum, declaration(text))
+			}
+			inEnum = true
+			if body := strings.Index(text, "{"); body != -1 {
+				inEnum = !strings.Contains(text, "}")
+				for _, e := range strings.Split(strings.TrimRight(text[body+1:], "};"), ",") {
+					if m := matchEnumerator.FindStringSubmatch(strings.TrimSpace(e)); m != nil {
+						add(m[1], SymbolEnumerator, strings.TrimSpace(e))
+					}
+				}
+			}
+		}
+	}
+
+	return
+}
+
+// declaration trims a function or enum body and terminator from a line
+func declaration(text string) string {
+	if i := strings.IndexAny(text, "{;"); i != -1 {
+		text = text[:i]
+	}
+	return text
+}
+
+// stripComments blanks out comments while keeping line breaks so line numbers stay correct.
+func stripComments(src []byte) []byte {
+	out := make([]byte, 0, len(src))
+	for i := 0; i < len(src); i++ {
+		switch {
+		case src[i] == '"':
+			// copy string literals verbatim so "//" inside them isn't treated as a comment
+			out = append(out, src[i])
+			for i++; i < len(src) && src[i] != '"' && src[i] != '\n'; i++ {
+				out = append(out, src[i])
+				if src[i] == '\\' && i+1 < len(src) {
+					i++
+					out = append(out, src[i])
+				}
+			}
+			if i < len(src) {
+				out = append(out, src[i])
+			}
+		case src[i] == '/' && i+1 < len(src) && src[i+1] == '/':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+			if i < len(src) {
+				out = append(out, '\n')
+			}
+		case src[i] == '/' && i+1 < len(src) && src[i+1] == '*':
+			for i += 2; i < len(src) && !(src[i] == '*' && i+1 < len(src) && src[i+1] == '/'); i++ {
+				if src[i] == '\n' {
+					out = append(out, '\n')
+				}
+			}
+			i++
+		default:
+			out = append(out, src[i])
+		}
+	}
+	return out
+}
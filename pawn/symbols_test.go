@@ -0,0 +1,60 @@
+package pawn
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSymbols(t *testing.T) {
+	src := `/*
+	native Commented(); // inside a block comment
+*/
+#if defined _inc_sscanf
+	#endinput
+#endif
+#define _inc_sscanf
+
+#define SSCANF_VERSION "2.8.3" // version
+#define Iter_Add(%0,%1) Iter_AddInternal(%0,%1)
+
+native SSCANF_Option(const name[], value);
+native bool:IsValidVehicle(vehicleid) = IsVehicleStreamedIn;
+forward OnSSCANFReady();
+stock Float:GetDistance(Float:x, Float:y) {
+	return x + y;
+}
+static stock Helper() {}
+public OnSSCANFReady() {
+	print("http://example.com");
+}
+
+enum E_PLAYER {
+	E_PLAYER_NAME[24],
+	Float:E_PLAYER_HEALTH,
+}
+
+enum { ANON_A, ANON_B }
+`
+
+	want := []Symbol{
+		{Name: "_inc_sscanf", Kind: SymbolGuard, Signature: "#define _inc_sscanf", Path: "sscanf2.inc", Line: 7},
+		{Name: "SSCANF_VERSION", Kind: SymbolDefine, Signature: `#define SSCANF_VERSION "2.8.3"`, Path: "sscanf2.inc", Line: 9},
+		{Name: "Iter_Add", Kind: SymbolDefine, Signature: "#define Iter_Add(%0,%1) Iter_AddInternal(%0,%1)", Path: "sscanf2.inc", Line: 10},
+		{Name: "SSCANF_Option", Kind: SymbolNative, Signature: "native SSCANF_Option(const name[], value)", Path: "sscanf2.inc", Line: 12},
+		{Name: "IsValidVehicle", Kind: SymbolNative, Signature: "native bool:IsValidVehicle(vehicleid) = IsVehicleStreamedIn", Path: "sscanf2.inc", Line: 13},
+		{Name: "OnSSCANFReady", Kind: SymbolForward, Signature: "forward OnSSCANFReady()", Path: "sscanf2.inc", Line: 14},
+		{Name: "GetDistance", Kind: SymbolStock, Signature: "stock Float:GetDistance(Float:x, Float:y)", Path: "sscanf2.inc", Line: 15},
+		{Name: "Helper", Kind: SymbolStock, Signature: "static stock Helper()", Path: "sscanf2.inc", Line: 18},
+		{Name: "OnSSCANFReady", Kind: SymbolPublic, Signature: "public OnSSCANFReady()", Path: "sscanf2.inc", Line: 19},
+		{Name: "E_PLAYER", Kind: SymbolEnum, Signature: "enum E_PLAYER", Path: "sscanf2.inc", Line: 23},
+		{Name: "E_PLAYER_NAME", Kind: SymbolEnumerator, Signature: "E_PLAYER_NAME[24]", Path: "sscanf2.inc", Line: 24},
+		{Name: "E_PLAYER_HEALTH", Kind: SymbolEnumerator, Signature: "Float:E_PLAYER_HEALTH", Path: "sscanf2.inc", Line: 25},
+		{Name: "ANON_A", Kind: SymbolEnumerator, Signature: "ANON_A", Path: "sscanf2.inc", Line: 28},
+		{Name: "ANON_B", Kind: SymbolEnumerator, Signature: "ANON_B", Path: "sscanf2.inc", Line: 28},
+	}
+
+	got := ParseSymbols("sscanf2.inc", []byte(src))
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseSymbols() =\n%v\nwant\n%v", got, want)
+	}
+}
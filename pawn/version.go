@@ -0,0 +1,27 @@
+package pawn
+
+import (
+	"github.com/Masterminds/semver"
+)
+
+// LatestVersion returns the tag with the highest semantic version that satisfies the constraint. A
+// nil constraint matches any version. Tags that aren't valid semantic versions are skipped and
+// prereleases are only considered when prerelease is true.
+func LatestVersion(tags []string, constraint *semver.Constraints, prerelease bool) (tag string, version *semver.Version, ok bool) {
+	for _, t := range tags {
+		v, err := semver.NewVersion(t)
+		if err != nil {
+			continue
+		}
+		if v.Prerelease() != "" && !prerelease {
+			continue
+		}
+		if constraint != nil && !constraint.Check(v) {
+			continue
+		}
+		if version == nil || v.GreaterThan(version) {
+			tag, version, ok = t, v, true
+		}
+	}
+	return
+}
@@ -0,0 +1,47 @@
+package pawn
+
+import (
+	"testing"
+
+	"github.com/Masterminds/semver"
+)
+
+func TestLatestVersion(t *testing.T) {
+	tags := []string{"v1.0.0", "1.10.0", "v1.2.3", "2.0.0-rc1", "nightly", "v1.9.9"}
+
+	tests := []struct {
+		name       string
+		tags       []string
+		constraint string
+		prerelease bool
+		wantTag    string
+		wantOk     bool
+	}{
+		{"highest", tags, "", false, "1.10.0", true},
+		{"prerelease", tags, "", true, "2.0.0-rc1", true},
+		{"constraint", tags, "~1.2", false, "v1.2.3", true},
+		{"caret", tags, "^1.2", false, "1.10.0", true},
+		{"no match", tags, "^3", false, "", false},
+		{"no semver", []string{"nightly", "latest"}, "", false, "", false},
+		{"empty", nil, "", false, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var constraint *semver.Constraints
+			if tt.constraint != "" {
+				var err error
+				constraint, err = semver.NewConstraint(tt.constraint)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			gotTag, _, gotOk := LatestVersion(tt.tags, constraint, tt.prerelease)
+			if gotTag != tt.wantTag {
+				t.Errorf("LatestVersion() gotTag = %v, want %v", gotTag, tt.wantTag)
+			}
+			if gotOk != tt.wantOk {
+				t.Errorf("LatestVersion() gotOk = %v, want %v", gotOk, tt.wantOk)
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+// Package ratelimit keeps API clients within their rate limits by holding requests back until the
+// limit resets, rather than letting them fail.
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Budget spends the rate limit of the GitHub API. It reads the X-RateLimit headers of every
+// response and once a window is down to its reserve, requests that count towards it wait for the
+// window to reset. The search APIs are limited separately from the rest of the API, so each
+// resource has its own window.
+type Budget struct {
+	// Reserve is the fraction of each window's limit left unspent, for requests that don't go
+	// through the budget such as those made with the same token elsewhere
+	Reserve float64
+
+	mu      sync.Mutex
+	windows map[string]*window
+}
+
+// window is the state of the rate limit of a resource
+type window struct {
+	limit     int
+	remaining int
+	reset     time.Time
+}
+
+// Window returns the last known state of a resource's rate limit, known is false if no response
+// has reported it yet
+func (b *Budget) Window(resource string) (limit, remaining int, reset time.Time, known bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	w, ok := b.windows[resource]
+	if !ok {
+		return 0, 0, time.Time{}, false
+	}
+	return w.limit, w.remaining, w.reset, true
+}
+
+// Transport wraps base, or http.DefaultTransport if it's nil, so every request made through it is
+// counted against the budget
+func (b *Budget) Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &transport{b, base}
+}
+
+// wait blocks until a request to the resource fits in the budget, and counts it
+func (b *Budget) wait(ctx context.Context, resource string) error {
+	for {
+		b.mu.Lock()
+		w, ok := b.windows[resource]
+		if !ok || !time.Now().Before(w.reset) || float64(w.remaining) > b.Reserve*float64(w.limit) {
+			if ok {
+				// other requests may be sent before this one's response updates the window
+				w.remaining--
+			}
+			b.mu.Unlock()
+			return nil
+		}
+		reset := w.reset
+		b.mu.Unlock()
+
+		zap.L().Info("rate limit budget spent, waiting for reset",
+			zap.String("resource", resource), zap.Time("reset", reset))
+
+		t := time.NewTimer(time.Until(reset))
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// update records the rate limit reported by a response
+func (b *Budget) update(resource string, resp *http.Response) {
+	if r := resp.Header.Get("X-RateLimit-Resource"); r != "" {
+		resource = r
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.windows == nil {
+		b.windows = map[string]*window{}
+	}
+	w, ok := b.windows[resource]
+	if !ok {
+		w = &window{}
+		b.windows[resource] = w
+	}
+
+	limit, errLimit := strconv.Atoi(resp.Header.Get("X-RateLimit-Limit"))
+	remaining, errRemaining := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining"))
+	reset, errReset := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64)
+	if errLimit == nil && errRemaining == nil && errReset == nil {
+		w.limit = limit
+		w.remaining = remaining
+		w.reset = time.Unix(reset, 0)
+	}
+
+	// secondary rate limits ask for a pause without spending the primary limit
+	if resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusTooManyRequests {
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			w.remaining = 0
+			w.reset = time.Now().Add(time.Duration(seconds) * time.Second)
+		}
+	}
+}
+
+// resource returns the rate limit resource a request is expected to count towards, responses
+// name the resource they counted towards
+func resource(r *http.Request) string {
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/search/code"):
+		return "code_search"
+	case strings.Contains(r.URL.Path, "/search/"):
+		return "search"
+	default:
+		return "core"
+	}
+}
+
+type transport struct {
+	budget *Budget
+	base   http.RoundTripper
+}
+
+func (t *transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	res := resource(r)
+	if err := t.budget.wait(r.Context(), res); err != nil {
+		return nil, err
+	}
+	resp, err := t.base.RoundTrip(r)
+	if err != nil {
+		return nil, err
+	}
+	t.budget.update(res, resp)
+	return resp, nil
+}
@@ -0,0 +1,97 @@
+package ratelimit_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Southclaws/pawndex/ratelimit"
+)
+
+func TestBudget(t *testing.T) {
+	reset := time.Now().Add(time.Second).Truncate(time.Second).Add(time.Second)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Limit", "10")
+		w.Header().Set("X-RateLimit-Remaining", "1")
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+		if r.URL.Path == "/search/repositories" {
+			w.Header().Set("X-RateLimit-Resource", "search")
+		} else {
+			w.Header().Set("X-RateLimit-Resource", "core")
+		}
+	}))
+	defer server.Close()
+
+	budget := &ratelimit.Budget{Reserve: 0.1}
+	client := http.Client{Transport: budget.Transport(nil)}
+
+	get := func(ctx context.Context, path string) error {
+		req, err := http.NewRequest(http.MethodGet, server.URL+path, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req.WithContext(ctx))
+		if err != nil {
+			return err
+		}
+		return resp.Body.Close()
+	}
+
+	// nothing is known about the limit until the first response
+	if err := get(context.Background(), "/repos/a/b"); err != nil {
+		t.Fatal(err)
+	}
+	if limit, remaining, _, known := budget.Window("core"); !known || limit != 10 || remaining != 1 {
+		t.Errorf("Window() = %d, %d, %v, want the limit from the response", limit, remaining, known)
+	}
+
+	// one request left is within the reserve so the next one waits for the reset
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := get(ctx, "/repos/a/b"); err == nil {
+		t.Error("request was sent before the reset")
+	}
+
+	// searches are limited separately
+	if err := get(context.Background(), "/search/repositories"); err != nil {
+		t.Fatal(err)
+	}
+
+	started := time.Now()
+	if err := get(context.Background(), "/repos/a/b"); err != nil {
+		t.Fatal(err)
+	}
+	if time.Now().Before(reset) {
+		t.Errorf("request was sent after %v, before the reset", time.Since(started))
+	}
+}
+
+func TestBudget_RetryAfter(t *testing.T) {
+	limited := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if limited {
+			limited = false
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	defer server.Close()
+
+	budget := &ratelimit.Budget{Reserve: 0.1}
+	client := http.Client{Transport: budget.Transport(nil)}
+
+	started := time.Now()
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	if elapsed := time.Since(started); elapsed < time.Second {
+		t.Errorf("second request was sent after %v, before the secondary limit passed", elapsed)
+	}
+}
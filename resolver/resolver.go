@@ -0,0 +1,373 @@
+package resolver
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/semver"
+	"github.com/Southclaws/sampctl/pawnpackage"
+	"github.com/Southclaws/sampctl/versioning"
+	"github.com/pkg/errors"
+
+	"github.com/Southclaws/pawndex/pawn"
+	"github.com/Southclaws/pawndex/storage"
+)
+
+// maxIterations bounds how many times selections are revised before giving up. Selecting a new
+// version of a package can change the dependencies it declares, so the tree is walked until the
+// selections stop changing.
+const maxIterations = 10
+
+// Resolver resolves dependency trees using the packages and versions stored in the index instead of
+// querying each repository individually.
+type Resolver struct {
+	Storer storage.Storer
+}
+
+// Requirement is a single dependency string and the package that declared it, an empty RequiredBy
+// means the dependency was requested directly.
+type Requirement struct {
+	Dependency versioning.DependencyString `json:"dependency"`
+	RequiredBy string                      `json:"required_by,omitempty"`
+}
+
+// Resolved is a package in the resolved tree along with the version chosen for it. If no tag,
+// branch or commit is set, the default branch was chosen.
+type Resolved struct {
+	versioning.DependencyMeta
+	Dependencies []string `json:"dependencies"`
+}
+
+// Conflict describes a package whose requirements cannot all be satisfied by one version.
+type Conflict struct {
+	Package      string        `json:"package"`
+	Requirements []Requirement `json:"requirements"`
+}
+
+// Unresolvable describes a requirement that could not be resolved at all.
+type Unresolvable struct {
+	Requirement
+	Reason string `json:"reason"`
+}
+
+// Result is a resolved dependency tree, Packages contains every package in the tree keyed by name
+// and Dependencies lists the names of the direct dependencies.
+type Result struct {
+	Dependencies []string            `json:"dependencies"`
+	Packages     map[string]Resolved `json:"packages"`
+	Conflicts    []Conflict          `json:"conflicts"`
+	Unresolvable []Unresolvable      `json:"unresolvable"`
+}
+
+// requirement is a parsed Requirement
+type requirement struct {
+	Requirement
+	meta       versioning.DependencyMeta
+	constraint *semver.Constraints
+}
+
+// Resolve resolves the dependencies and development dependencies of a package definition.
+// Development dependencies are only considered for the root package.
+func (r *Resolver) Resolve(root pawnpackage.Package) (*Result, error) {
+	selected := map[string]Resolved{}
+
+	var (
+		result *Result
+		err    error
+	)
+	for i := 0; i < maxIterations; i++ {
+		var changed bool
+		result, changed, err = r.walk(root, selected)
+		if err != nil {
+			return nil, err
+		}
+		if !changed {
+			break
+		}
+		selected = result.Packages
+	}
+
+	return result, nil
+}
+
+// walk traverses the tree from the root using the current selections, choosing versions for any
+// packages that haven't been selected yet, and reports whether any selection changed.
+func (r *Resolver) walk(root pawnpackage.Package, selected map[string]Resolved) (result *Result, changed bool, err error) {
+	result = &Result{
+		Dependencies: []string{},
+		Packages:     map[string]Resolved{},
+		Conflicts:    []Conflict{},
+		Unresolvable: []Unresolvable{},
+	}
+
+	// found holds the package each name was found as, keyed by lowercase name as dependencies can
+	// be spelled in any case, nil if it isn't indexed
+	found := map[string]*pawn.Package{}
+	lookup := func(meta versioning.DependencyMeta) (string, *pawn.Package, error) {
+		name := packageName(meta)
+		pkg, ok := found[strings.ToLower(name)]
+		if !ok {
+			p, exists, err := r.Storer.Lookup(name)
+			if err != nil {
+				return "", nil, errors.Wrapf(err, "failed to get package %s", name)
+			}
+			if exists {
+				pkg = &p
+			}
+			found[strings.ToLower(name)] = pkg
+		}
+		if pkg == nil {
+			return name, nil, nil
+		}
+		return pkg.String(), pkg, nil
+	}
+
+	requirements := map[string][]requirement{}
+	queue := []requirement{}
+	enqueue := func(deps []versioning.DependencyString, requiredBy string) ([]string, error) {
+		names := []string{}
+		for _, d := range deps {
+			req, err := parseRequirement(Requirement{d, requiredBy})
+			if err != nil {
+				result.Unresolvable = append(result.Unresolvable, Unresolvable{Requirement{d, requiredBy}, err.Error()})
+				continue
+			}
+			name, _, err := lookup(req.meta)
+			if err != nil {
+				return nil, err
+			}
+			names = append(names, name)
+			if _, seen := requirements[name]; !seen {
+				queue = append(queue, req)
+			}
+			requirements[name] = append(requirements[name], req)
+		}
+		return names, nil
+	}
+
+	if result.Dependencies, err = enqueue(root.GetAllDependencies(), ""); err != nil {
+		return nil, false, err
+	}
+
+	for len(queue) > 0 {
+		req := queue[0]
+		queue = queue[1:]
+
+		name, pkg, err := lookup(req.meta)
+		if err != nil {
+			return nil, false, err
+		}
+		if pkg == nil {
+			result.Unresolvable = append(result.Unresolvable, Unresolvable{req.Requirement, "package is not indexed"})
+			continue
+		}
+
+		resolved, ok := selected[name]
+		if !ok {
+			resolved, ok = choose(*pkg, requirements[name])
+			if !ok {
+				// the requirements conflict, carry on with this one so the rest of the tree can
+				// be resolved and let the conflict be reported below
+				resolved, ok = choose(*pkg, []requirement{req})
+			}
+			if !ok {
+				result.Unresolvable = append(result.Unresolvable, Unresolvable{req.Requirement, "no version satisfies the requirement"})
+				continue
+			}
+		}
+
+		definition, ok, err := r.definition(*pkg, resolved)
+		if err != nil {
+			return nil, false, err
+		}
+		if !ok {
+			result.Unresolvable = append(result.Unresolvable, Unresolvable{req.Requirement,
+				fmt.Sprintf("dependencies at commit %s are not indexed", resolved.Commit)})
+			continue
+		}
+		if resolved.Commit == "" {
+			resolved.Commit = definition.Commit
+		}
+		if resolved.Dependencies, err = enqueue(definition.Dependencies, name); err != nil {
+			return nil, false, err
+		}
+		result.Packages[name] = resolved
+	}
+
+	// now every requirement is known, check the selections still satisfy them and revise any that
+	// don't, reporting those that can't be satisfied at all
+	for name, resolved := range result.Packages {
+		best, ok := choose(*found[strings.ToLower(name)], requirements[name])
+		if !ok {
+			conflict := Conflict{Package: name}
+			for _, req := range requirements[name] {
+				conflict.Requirements = append(conflict.Requirements, req.Requirement)
+			}
+			result.Conflicts = append(result.Conflicts, conflict)
+			continue
+		}
+		if best.Tag != resolved.Tag || best.Branch != resolved.Branch || (best.Commit != "" && best.Commit != resolved.Commit) {
+			best.Dependencies = resolved.Dependencies
+			result.Packages[name] = best
+			changed = true
+		}
+	}
+
+	sort.Slice(result.Conflicts, func(i, j int) bool {
+		return result.Conflicts[i].Package < result.Conflicts[j].Package
+	})
+
+	return result, changed, nil
+}
+
+// definition returns the package definition declared at the selected version. A tag without a
+// definition falls back to the default branch definition, as does no tag being selected. A commit
+// is only known if a tag points to it, otherwise ok is false.
+func (r *Resolver) definition(pkg pawn.Package, resolved Resolved) (definition pawnpackage.Package, ok bool, err error) {
+	switch {
+	case resolved.Tag != "":
+		version, exists, err := r.Storer.GetVersion(pkg.String(), resolved.Tag)
+		if err != nil {
+			return version, false, errors.Wrapf(err, "failed to get version %s of %s", resolved.Tag, pkg.String())
+		}
+		if exists {
+			return version, true, nil
+		}
+
+	case resolved.Commit != "":
+		versions, err := r.Storer.GetVersions(pkg.String())
+		if err != nil {
+			return definition, false, errors.Wrapf(err, "failed to get versions of %s", pkg.String())
+		}
+		for _, v := range versions {
+			if v.Commit == resolved.Commit {
+				return v, true, nil
+			}
+		}
+		return definition, false, nil
+	}
+
+	definition = pkg.Package
+	definition.Commit = ""
+	return definition, true, nil
+}
+
+// choose selects the version of a package that satisfies every requirement. Branch and commit pins
+// must agree with each other and with any constraints, otherwise the highest tag matching every
+// constraint is chosen. Without any requirements on the version, the default branch is chosen.
+func choose(pkg pawn.Package, reqs []requirement) (resolved Resolved, ok bool) {
+	resolved.Site = pkg.Site
+	if resolved.Site == "" {
+		resolved.Site = pawn.DefaultSite // stored before packages were named with their host
+	}
+	resolved.User = pkg.User
+	resolved.Repo = pkg.Repo
+
+	var (
+		constraints []*semver.Constraints
+		exact       []string
+	)
+	for _, req := range reqs {
+		switch {
+		case req.meta.Commit != "":
+			if resolved.Commit != "" && resolved.Commit != req.meta.Commit {
+				return resolved, false
+			}
+			resolved.Commit = req.meta.Commit
+		case req.meta.Branch != "" && req.constraint == nil:
+			if resolved.Branch != "" && resolved.Branch != req.meta.Branch {
+				return resolved, false
+			}
+			resolved.Branch = req.meta.Branch
+		case req.constraint != nil:
+			constraints = append(constraints, req.constraint)
+		case req.meta.Tag != "":
+			exact = append(exact, req.meta.Tag)
+		}
+	}
+
+	if resolved.Commit != "" && resolved.Branch != "" {
+		return resolved, false
+	}
+	if len(constraints) == 0 && len(exact) == 0 {
+		return resolved, true
+	}
+	if resolved.Commit != "" || resolved.Branch != "" {
+		return resolved, false
+	}
+
+	candidates := []string{}
+	for _, tag := range pkg.Tags {
+		if matchesExact(tag, exact) {
+			candidates = append(candidates, tag)
+		}
+	}
+
+	// exact tags that aren't semantic versions can only be matched by name
+	if len(constraints) == 0 && len(candidates) == 1 {
+		resolved.Tag = candidates[0]
+		return resolved, true
+	}
+
+	tag, version, found := pawn.LatestVersion(candidates, nil, true)
+	for found {
+		satisfied := true
+		for _, c := range constraints {
+			if !c.Check(version) {
+				satisfied = false
+				break
+			}
+		}
+		if satisfied {
+			resolved.Tag = tag
+			return resolved, true
+		}
+
+		// discard the candidate and try the next highest
+		remaining := candidates[:0]
+		for _, t := range candidates {
+			if t != tag {
+				remaining = append(remaining, t)
+			}
+		}
+		candidates = remaining
+		tag, version, found = pawn.LatestVersion(candidates, nil, true)
+	}
+
+	return resolved, false
+}
+
+func matchesExact(tag string, exact []string) bool {
+	for _, e := range exact {
+		if tag != e {
+			return false
+		}
+	}
+	return true
+}
+
+// parseRequirement explodes a dependency string. A tag, or a branch that looks like a version
+// constraint, is treated as a semantic version constraint.
+func parseRequirement(r Requirement) (req requirement, err error) {
+	req.Requirement = r
+	req.meta, err = r.Dependency.Explode()
+	if err != nil {
+		return req, errors.Wrap(err, "invalid dependency string")
+	}
+
+	version := req.meta.Tag
+	if version == "" {
+		version = req.meta.Branch
+	}
+	if version != "" {
+		if c, err := semver.NewConstraint(version); err == nil {
+			req.constraint = c
+		}
+	}
+	return req, nil
+}
+
+func packageName(meta versioning.DependencyMeta) string {
+	return pawn.Name(meta.Site, meta.User, meta.Repo)
+}
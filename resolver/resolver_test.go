@@ -0,0 +1,152 @@
+package resolver
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Southclaws/sampctl/pawnpackage"
+	"github.com/Southclaws/sampctl/versioning"
+
+	"github.com/Southclaws/pawndex/pawn"
+	"github.com/Southclaws/pawndex/storage"
+	"github.com/Southclaws/pawndex/storagetest"
+)
+
+func version(user, repo, tag string, deps ...versioning.DependencyString) pawnpackage.Package {
+	return pawnpackage.Package{
+		DependencyMeta: versioning.DependencyMeta{User: user, Repo: repo, Tag: tag, Commit: tag + "-sha"},
+		Dependencies:   deps,
+	}
+}
+
+// withCommit sets the commit a version is tagged at
+func withCommit(p pawnpackage.Package, commit string) pawnpackage.Package {
+	p.Commit = commit
+	return p
+}
+
+// taggedCommit is the commit test/a 1.1.0 is tagged at
+const taggedCommit = "a11a11a11a11a11a11a11a11a11a11a11a11a11a"
+
+func newTestStore(t *testing.T) *storage.DB {
+	db := storagetest.NewStore(t)
+
+	for _, p := range []pawn.Package{
+		{
+			Package: pawnpackage.Package{DependencyMeta: versioning.DependencyMeta{User: "test", Repo: "a"}},
+			Tags:    []string{"2.0.0", "1.1.0", "1.0.0"},
+			Versions: []pawnpackage.Package{
+				version("test", "a", "1.0.0"),
+				withCommit(version("test", "a", "1.1.0", "test/b:^1"), taggedCommit),
+				version("test", "a", "2.0.0", "test/b:^2"),
+			},
+		},
+		{
+			Package: pawnpackage.Package{DependencyMeta: versioning.DependencyMeta{User: "test", Repo: "b"}},
+			Tags:    []string{"2.0.0", "1.2.0", "1.0.0"},
+			Versions: []pawnpackage.Package{
+				version("test", "b", "1.0.0"),
+				version("test", "b", "1.2.0"),
+				version("test", "b", "2.0.0"),
+			},
+		},
+		{
+			Package: pawnpackage.Package{
+				DependencyMeta: versioning.DependencyMeta{User: "test", Repo: "c"},
+				Dependencies:   []versioning.DependencyString{"test/b:~1.0"},
+			},
+		},
+		{
+			Package: pawnpackage.Package{
+				DependencyMeta: versioning.DependencyMeta{User: "test", Repo: "d"},
+				Dependencies:   []versioning.DependencyString{"test/b:~1.0"},
+			},
+			Tags: []string{"1.0.0"}, // without a definition
+		},
+	} {
+		p.Classification = pawn.ClassificationPawnPackage
+		if err := db.Set(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return db
+}
+
+func TestResolver_Resolve(t *testing.T) {
+	r := Resolver{Storer: newTestStore(t)}
+
+	tests := []struct {
+		name             string
+		deps             []versioning.DependencyString
+		wantTags         map[string]string
+		wantConflicts    []string
+		wantUnresolvable []versioning.DependencyString
+	}{
+		{"transitive", []versioning.DependencyString{"test/a:^1"}, map[string]string{
+			"github.com/test/a": "1.1.0",
+			"github.com/test/b": "1.2.0",
+		}, nil, nil},
+		{"shared", []versioning.DependencyString{"test/a:^1", "test/c"}, map[string]string{
+			"github.com/test/a": "1.1.0",
+			"github.com/test/b": "1.0.0",
+			"github.com/test/c": "",
+		}, nil, nil},
+		{"conflict", []versioning.DependencyString{"test/a:^2", "test/c"}, map[string]string{
+			"github.com/test/a": "2.0.0",
+			"github.com/test/b": "2.0.0",
+			"github.com/test/c": "",
+		}, []string{"github.com/test/b"}, nil},
+		{"unresolvable", []versioning.DependencyString{"test/missing", "test/a:^3"}, map[string]string{},
+			nil, []versioning.DependencyString{"test/missing", "test/a:^3"}},
+		{"tag without definition", []versioning.DependencyString{"test/d:1.0.0"}, map[string]string{
+			"github.com/test/d": "1.0.0",
+			"github.com/test/b": "1.0.0",
+		}, nil, nil},
+		{"case", []versioning.DependencyString{"TEST/A:^1"}, map[string]string{
+			"github.com/test/a": "1.1.0",
+			"github.com/test/b": "1.2.0",
+		}, nil, nil},
+		{"tagged commit", []versioning.DependencyString{"test/a#" + taggedCommit}, map[string]string{
+			"github.com/test/a": "",
+			"github.com/test/b": "1.2.0",
+		}, nil, nil},
+		{"untagged commit", []versioning.DependencyString{"test/b#0000000000000000000000000000000000000000"}, map[string]string{},
+			nil, []versioning.DependencyString{"test/b#0000000000000000000000000000000000000000"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := r.Resolve(pawnpackage.Package{Dependencies: tt.deps})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			gotTags := map[string]string{}
+			for name, p := range got.Packages {
+				gotTags[name] = p.Tag
+				if p.Site != pawn.DefaultSite {
+					t.Errorf("Resolve() %s site = %q, want %q", name, p.Site, pawn.DefaultSite)
+				}
+			}
+			if !reflect.DeepEqual(gotTags, tt.wantTags) {
+				t.Errorf("Resolve() tags = %v, want %v", gotTags, tt.wantTags)
+			}
+
+			var gotConflicts []string
+			for _, c := range got.Conflicts {
+				gotConflicts = append(gotConflicts, c.Package)
+			}
+			if !reflect.DeepEqual(gotConflicts, tt.wantConflicts) {
+				t.Errorf("Resolve() conflicts = %v, want %v", gotConflicts, tt.wantConflicts)
+			}
+
+			var gotUnresolvable []versioning.DependencyString
+			for _, u := range got.Unresolvable {
+				gotUnresolvable = append(gotUnresolvable, u.Dependency)
+			}
+			if !reflect.DeepEqual(gotUnresolvable, tt.wantUnresolvable) {
+				t.Errorf("Resolve() unresolvable = %v, want %v", gotUnresolvable, tt.wantUnresolvable)
+			}
+		})
+	}
+}
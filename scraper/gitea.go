@@ -0,0 +1,132 @@
+package scraper
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"github.com/Southclaws/sampctl/versioning"
+	"github.com/pkg/errors"
+
+	"github.com/Southclaws/pawndex/gitea"
+	"github.com/Southclaws/pawndex/pawn"
+)
+
+// giteaPageSize is the number of items requested per page, Gitea caps this at its configured
+// MAX_RESPONSE_ITEMS which defaults to 50.
+const giteaPageSize = 50
+
+// giteaTreePageSize is the number of tree entries requested per page, trees are paged separately
+// and capped at DEFAULT_GIT_TREES_PER_PAGE which defaults to 1000.
+const giteaTreePageSize = 1000
+
+// GiteaScraper scrapes repositories hosted on a Gitea or Forgejo instance
+type GiteaScraper struct {
+	Gitea *gitea.Client
+	// Index skips the tags that are already indexed, every tag is read without one
+	Index Index
+}
+
+func (g *GiteaScraper) Scrape(ctx context.Context, name string) (*pawn.Package, error) {
+	return scrape(ctx, g, g.Index, name)
+}
+
+func (g *GiteaScraper) Lookup(ctx context.Context, name string) (string, bool, error) {
+	return lookup(ctx, g, name)
+}
+
+func (g *GiteaScraper) repository(ctx context.Context, meta versioning.DependencyMeta) (repository, error) {
+	var repo gitea.Repository
+	found, err := g.Gitea.Get(ctx, repoPath(meta, ""), nil, &repo)
+	if err != nil {
+		return repository{}, errors.Wrap(err, "failed to get repo metadata from gitea")
+	}
+	if !found {
+		return repository{}, ErrNotFound
+	}
+
+	var topics struct {
+		Topics []string `json:"topics"`
+	}
+	if _, err := g.Gitea.Get(ctx, repoPath(meta, "/topics"), nil, &topics); err != nil {
+		return repository{}, errors.Wrap(err, "failed to get repo topics from gitea")
+	}
+
+	return repository{
+		meta: versioning.DependencyMeta{
+			Site: g.Gitea.Site(),
+			User: repo.Owner.Login,
+			Repo: repo.Name,
+		},
+		description:   repo.Description,
+		stars:         repo.Stars,
+		updated:       repo.Updated,
+		topics:        topics.Topics,
+		defaultBranch: repo.DefaultBranch,
+		archived:      repo.Archived,
+	}, nil
+}
+
+func (g *GiteaScraper) head(ctx context.Context, meta versioning.DependencyMeta, branch string) (sha string, err error) {
+	var b gitea.Branch
+	found, err := g.Gitea.Get(ctx, repoPath(meta, "/branches/"+url.PathEscape(branch)), nil, &b)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to get HEAD ref from default branch")
+	}
+	if !found {
+		return "", errors.Errorf("branch %s not found", branch)
+	}
+	return b.Commit.ID, nil
+}
+
+func (g *GiteaScraper) tree(ctx context.Context, meta versioning.DependencyMeta, sha string) (paths []string, err error) {
+	for page := 1; ; page++ {
+		var tree gitea.Tree
+		if _, err = g.Gitea.Get(ctx, repoPath(meta, "/git/trees/"+sha), url.Values{
+			"recursive": []string{"true"},
+			"page":      []string{strconv.Itoa(page)},
+			"per_page":  []string{strconv.Itoa(giteaTreePageSize)},
+		}, &tree); err != nil {
+			err = errors.Wrap(err, "failed to get git tree")
+			return
+		}
+
+		for _, entry := range tree.Entries {
+			if entry.Type == "blob" {
+				paths = append(paths, entry.Path)
+			}
+		}
+		if !tree.Truncated || len(tree.Entries) == 0 {
+			return
+		}
+	}
+}
+
+// tags lists every tag in the repository, following pagination
+func (g *GiteaScraper) tags(ctx context.Context, meta versioning.DependencyMeta) (tags []tag, err error) {
+	for page := 1; ; page++ {
+		var result []gitea.Tag
+		if _, err := g.Gitea.Get(ctx, repoPath(meta, "/tags"), url.Values{
+			"page":  []string{strconv.Itoa(page)},
+			"limit": []string{strconv.Itoa(giteaPageSize)},
+		}, &result); err != nil {
+			return nil, errors.Wrap(err, "failed to list repo tags")
+		}
+		for _, t := range result {
+			tags = append(tags, tag{t.Name, t.Commit.SHA})
+		}
+		if len(result) < giteaPageSize {
+			return tags, nil
+		}
+	}
+}
+
+// file downloads a single file from a repository at the given ref
+func (g *GiteaScraper) file(ctx context.Context, meta versioning.DependencyMeta, ref, path string) (contents []byte, found bool, err error) {
+	return g.Gitea.Raw(ctx, meta.User, meta.Repo, ref, path)
+}
+
+func repoPath(meta versioning.DependencyMeta, suffix string) string {
+	return fmt.Sprintf("/repos/%s/%s%s", url.PathEscape(meta.User), url.PathEscape(meta.Repo), suffix)
+}
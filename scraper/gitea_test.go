@@ -0,0 +1,178 @@
+package scraper_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Southclaws/sampctl/pawnpackage"
+	"github.com/Southclaws/sampctl/versioning"
+
+	"github.com/Southclaws/pawndex/gitea"
+	"github.com/Southclaws/pawndex/pawn"
+	"github.com/Southclaws/pawndex/scraper"
+)
+
+// giteaRepo is a repository served by the fake Gitea API
+type giteaRepo struct {
+	files map[string]string // path to contents at the head of master
+	tags  map[string]string // tag name to commit
+}
+
+var updated = time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC)
+
+// newGiteaServer stands in for the parts of the Gitea API the scraper uses, every repo has a
+// master branch at commit "head" and tagged commits only contain a pawn.json.
+func newGiteaServer(repos map[string]giteaRepo) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/api/v1/repos/"), "/", 4)
+		if len(parts) < 2 {
+			http.NotFound(w, r)
+			return
+		}
+		repo, ok := repos[parts[0]+"/"+parts[1]]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		endpoint := ""
+		if len(parts) > 2 {
+			endpoint = parts[2]
+		}
+
+		switch endpoint {
+		case "":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"name":           parts[1],
+				"owner":          map[string]string{"login": parts[0]},
+				"description":    "a package",
+				"stars_count":    3,
+				"updated_at":     updated,
+				"default_branch": "master",
+			})
+		case "topics":
+			json.NewEncoder(w).Encode(map[string][]string{"topics": {"pawn-package"}})
+		case "branches":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"name":   "master",
+				"commit": map[string]string{"id": "head"},
+			})
+		case "git":
+			var entries []map[string]string
+			for path := range repo.files {
+				entries = append(entries, map[string]string{"path": path, "type": "blob"})
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"sha": "head", "tree": entries})
+		case "tags":
+			var tags []map[string]interface{}
+			if r.URL.Query().Get("page") == "1" {
+				for name, sha := range repo.tags {
+					tags = append(tags, map[string]interface{}{
+						"name":   name,
+						"commit": map[string]string{"sha": sha},
+					})
+				}
+			}
+			json.NewEncoder(w).Encode(tags)
+		case "raw":
+			contents, ok := repo.files[parts[3]]
+			if r.URL.Query().Get("ref") != "head" && parts[3] != "pawn.json" {
+				ok = false
+			}
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write([]byte(contents))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestGiteaScraper_Scrape(t *testing.T) {
+	server := newGiteaServer(map[string]giteaRepo{
+		"test/full": {
+			files: map[string]string{
+				"pawn.json": `{"user":"test","repo":"full","dependencies":["test/basic"]}`,
+				"full.inc":  "native Full();\n",
+			},
+			tags: map[string]string{"1.0.0": "v1"},
+		},
+		"test/basic": {
+			files: map[string]string{"basic.inc": "stock Basic() {}\n"},
+		},
+		"test/empty": {
+			files: map[string]string{"README.md": "nothing here"},
+		},
+	})
+	defer server.Close()
+
+	site := strings.TrimPrefix(server.URL, "http://")
+	s := scraper.GiteaScraper{Gitea: &gitea.Client{BaseURL: server.URL}}
+
+	tests := []struct {
+		name        string
+		wantPkg     *pawn.Package
+		wantSymbols []string
+		wantErr     bool
+	}{
+		{"test/full", &pawn.Package{
+			Package: pawnpackage.Package{
+				DependencyMeta: versioning.DependencyMeta{Site: site, User: "test", Repo: "full"},
+				Dependencies:   []versioning.DependencyString{"test/basic"},
+			},
+			Classification: pawn.ClassificationPawnPackage,
+			Description:    "a package",
+			Stars:          3,
+			Updated:        updated,
+			Topics:         []string{"pawn-package"},
+			Tags:           []string{"1.0.0"},
+			Includes:       []string{"full.inc"},
+			Requires:       []versioning.DependencyMeta{{Site: "github.com", User: "test", Repo: "basic"}},
+			Versions: []pawnpackage.Package{{
+				DependencyMeta: versioning.DependencyMeta{Site: site, User: "test", Repo: "full", Tag: "1.0.0", Commit: "v1"},
+				Dependencies:   []versioning.DependencyString{"test/basic"},
+			}},
+		}, []string{"Full"}, false},
+		{"test/basic", &pawn.Package{
+			Package: pawnpackage.Package{
+				DependencyMeta: versioning.DependencyMeta{Site: site, User: "test", Repo: "basic"},
+			},
+			Classification: pawn.ClassificationBarebones,
+			Description:    "a package",
+			Stars:          3,
+			Updated:        updated,
+			Topics:         []string{"pawn-package"},
+			Includes:       []string{"basic.inc"},
+		}, []string{"Basic"}, false},
+		{site + "/test/empty", nil, nil, false},
+		{"test/missing", nil, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotPkg, err := s.Scrape(context.Background(), tt.name)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GiteaScraper.Scrape() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			var gotSymbols []string
+			if gotPkg != nil {
+				gotSymbols = symbolNames(gotPkg.Symbols)
+				gotPkg.Symbols, gotPkg.Commits = nil, nil
+			}
+			if !reflect.DeepEqual(gotPkg, tt.wantPkg) {
+				t.Errorf("GiteaScraper.Scrape() = %#v, want %#v", gotPkg, tt.wantPkg)
+			}
+			if !reflect.DeepEqual(gotSymbols, tt.wantSymbols) {
+				t.Errorf("GiteaScraper.Scrape() symbols = %v, want %v", gotSymbols, tt.wantSymbols)
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package scraper
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Southclaws/sampctl/versioning"
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+
+	"github.com/Southclaws/pawndex/pawn"
+)
+
+// DefaultRawURL is where file contents are downloaded from for repositories on github.com
+const DefaultRawURL = "https://raw.githubusercontent.com/"
+
+type GitHubScraper struct {
+	GitHub *github.Client
+	// RawURL is the base URL of raw file contents, such as DefaultRawURL. If it's empty, files are
+	// read through the contents API instead which counts towards the rate limit.
+	RawURL string
+	// Site is the host packages are named with, defaults to github.com. For GitHub Enterprise
+	// Server this should be the host of the instance.
+	Site string
+	// Index skips the tags that are already indexed, every tag is read without one
+	Index Index
+}
+
+func (g *GitHubScraper) Scrape(ctx context.Context, name string) (*pawn.Package, error) {
+	return scrape(ctx, g, g.Index, name)
+}
+
+func (g *GitHubScraper) Lookup(ctx context.Context, name string) (string, bool, error) {
+	return lookup(ctx, g, name)
+}
+
+func (g *GitHubScraper) repository(ctx context.Context, meta versioning.DependencyMeta) (repository, error) {
+	repo, resp, err := g.GitHub.Repositories.Get(ctx, meta.User, meta.Repo)
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return repository{}, ErrNotFound
+		}
+		return repository{}, errors.Wrap(err, "failed to get repo metadata from github")
+	}
+
+	return repository{
+		meta: versioning.DependencyMeta{
+			Site: g.site(),
+			User: repo.Owner.GetLogin(),
+			Repo: repo.GetName(),
+		},
+		description:   repo.GetDescription(),
+		stars:         repo.GetStargazersCount(),
+		updated:       repo.GetUpdatedAt().Time,
+		topics:        repo.Topics,
+		defaultBranch: repo.GetDefaultBranch(),
+		archived:      repo.GetArchived(),
+	}, nil
+}
+
+func (g *GitHubScraper) head(ctx context.Context, meta versioning.DependencyMeta, branch string) (sha string, err error) {
+	ref, _, err := g.GitHub.Git.GetRef(ctx, meta.User, meta.Repo,
+		fmt.Sprintf("heads/%s", branch))
+	if err != nil {
+		return "", errors.Wrap(err, "failed to get HEAD ref from default branch")
+	}
+	return ref.GetObject().GetSHA(), nil
+}
+
+func (g *GitHubScraper) tree(ctx context.Context, meta versioning.DependencyMeta, sha string) (paths []string, err error) {
+	tree, _, err := g.GitHub.Git.GetTree(ctx, meta.User, meta.Repo, sha, true)
+	if err != nil {
+		err = errors.Wrap(err, "failed to get git tree")
+		return
+	}
+
+	for _, file := range tree.Entries {
+		paths = append(paths, file.GetPath())
+	}
+	return
+}
+
+// tags lists every tag in the repository, following pagination
+func (g *GitHubScraper) tags(ctx context.Context, meta versioning.DependencyMeta) (tags []tag, err error) {
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		page, resp, err := g.GitHub.Repositories.ListTags(ctx, meta.User, meta.Repo, opts)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to list repo tags")
+		}
+		for _, t := range page {
+			tags = append(tags, tag{t.GetName(), t.GetCommit().GetSHA()})
+		}
+		if resp.NextPage == 0 {
+			return tags, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// file downloads a single file from a repository at the given ref
+func (g *GitHubScraper) file(ctx context.Context, meta versioning.DependencyMeta, ref, path string) (contents []byte, found bool, err error) {
+	if g.RawURL == "" {
+		return g.contents(ctx, meta, ref, path)
+	}
+
+	client := http.Client{Timeout: time.Second * 10}
+
+	segments := strings.Split(path, "/")
+	for i := range segments {
+		segments[i] = url.PathEscape(segments[i])
+	}
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf(
+		"%s%s/%s/%s/%s",
+		g.RawURL, url.PathEscape(meta.User), url.PathEscape(meta.Repo), url.PathEscape(ref),
+		strings.Join(segments, "/"),
+	), nil)
+	if err != nil {
+		return
+	}
+
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	// anything but a missing file may be fixed by trying again, so it isn't taken as missing
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, false, errors.Errorf("failed to get raw file %s: %s", path, resp.Status)
+	}
+
+	contents, err = ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return
+	}
+	return contents, true, nil
+}
+
+// contents reads a single file through the contents API, for hosts without a raw content host
+func (g *GitHubScraper) contents(ctx context.Context, meta versioning.DependencyMeta, ref, path string) (contents []byte, found bool, err error) {
+	file, _, resp, err := g.GitHub.Repositories.GetContents(ctx, meta.User, meta.Repo, path,
+		&github.RepositoryContentGetOptions{Ref: ref})
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return nil, false, nil
+		}
+		return nil, false, errors.Wrap(err, "failed to get file contents")
+	}
+	if file == nil {
+		return nil, false, nil // path is a directory
+	}
+
+	content, err := file.GetContent()
+	if err != nil {
+		return nil, false, errors.Wrap(err, "failed to decode file contents")
+	}
+	return []byte(content), true, nil
+}
+
+func (g *GitHubScraper) site() string {
+	if g.Site == "" {
+		return pawn.DefaultSite
+	}
+	return g.Site
+}
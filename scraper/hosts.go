@@ -0,0 +1,41 @@
+package scraper
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/Southclaws/pawndex/pawn"
+)
+
+// Hosts dispatches each scrape to the Scraper for the host the package lives on, keyed by host name
+// such as "github.com". Package names without a host are assumed to be on the default site.
+type Hosts map[string]Scraper
+
+func (h Hosts) Scrape(ctx context.Context, name string) (*pawn.Package, error) {
+	meta, err := pawn.ParseName(name)
+	if err != nil {
+		return nil, err
+	}
+	s, ok := h[meta.Site]
+	if !ok {
+		return nil, errors.Errorf("no scraper configured for host %s", meta.Site)
+	}
+	return s.Scrape(ctx, name)
+}
+
+func (h Hosts) Lookup(ctx context.Context, name string) (string, bool, error) {
+	meta, err := pawn.ParseName(name)
+	if err != nil {
+		return "", false, err
+	}
+	s, ok := h[meta.Site]
+	if !ok {
+		return "", false, nil
+	}
+	c, ok := s.(Checker)
+	if !ok {
+		return "", false, errors.Errorf("scraper for host %s can't look up repositories", meta.Site)
+	}
+	return c.Lookup(ctx, name)
+}
@@ -0,0 +1,174 @@
+package scraper
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/Southclaws/sampctl/versioning"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/pkg/errors"
+
+	"github.com/Southclaws/pawndex/pawn"
+)
+
+// LocalScraper scrapes git repositories from a directory on disk instead of a remote host. The
+// directory is laid out as Root/user/repo, where each repo is either a working copy or a bare
+// repository which may end in .git, such as a set of mirrors.
+type LocalScraper struct {
+	Root string // directory containing a directory of repositories for each user
+	Site string // host name the packages are named with, such as "local"
+	// Index skips the tags that are already indexed, every tag is read without one
+	Index Index
+}
+
+func (l *LocalScraper) Scrape(ctx context.Context, name string) (*pawn.Package, error) {
+	return scrape(ctx, l, l.Index, name)
+}
+
+// open finds and opens the repository for a package under the root directory
+func (l *LocalScraper) open(meta versioning.DependencyMeta) (*git.Repository, error) {
+	for _, dir := range []string{meta.Repo, meta.Repo + ".git"} {
+		path := filepath.Join(l.Root, filepath.Clean("/"+meta.User), filepath.Clean("/"+dir))
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		return git.PlainOpen(path)
+	}
+	return nil, ErrNotFound
+}
+
+func (l *LocalScraper) Lookup(ctx context.Context, name string) (string, bool, error) {
+	return lookup(ctx, l, name)
+}
+
+func (l *LocalScraper) repository(ctx context.Context, meta versioning.DependencyMeta) (repository, error) {
+	repo, err := l.open(meta)
+	if err != nil {
+		return repository{}, err
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		return repository{}, errors.Wrap(err, "failed to get HEAD of repository")
+	}
+	commit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return repository{}, errors.Wrap(err, "failed to get HEAD commit")
+	}
+
+	return repository{
+		meta: versioning.DependencyMeta{
+			Site: l.Site,
+			User: meta.User,
+			Repo: meta.Repo,
+		},
+		updated:       commit.Committer.When.UTC(),
+		defaultBranch: head.Name().Short(),
+	}, nil
+}
+
+func (l *LocalScraper) head(ctx context.Context, meta versioning.DependencyMeta, branch string) (sha string, err error) {
+	repo, err := l.open(meta)
+	if err != nil {
+		return
+	}
+
+	ref, err := repo.Reference(plumbing.NewBranchReferenceName(branch), true)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to get HEAD ref from default branch")
+	}
+	return ref.Hash().String(), nil
+}
+
+func (l *LocalScraper) tree(ctx context.Context, meta versioning.DependencyMeta, sha string) (paths []string, err error) {
+	repo, err := l.open(meta)
+	if err != nil {
+		return
+	}
+
+	commit, err := repo.CommitObject(plumbing.NewHash(sha))
+	if err != nil {
+		err = errors.Wrap(err, "failed to get commit")
+		return
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		err = errors.Wrap(err, "failed to get git tree")
+		return
+	}
+
+	err = tree.Files().ForEach(func(f *object.File) error {
+		paths = append(paths, f.Name)
+		return nil
+	})
+	return
+}
+
+// tags lists every tag in the repository, annotated tags are resolved to the commit they point to
+func (l *LocalScraper) tags(ctx context.Context, meta versioning.DependencyMeta) (tags []tag, err error) {
+	repo, err := l.open(meta)
+	if err != nil {
+		return nil, err
+	}
+
+	iter, err := repo.Tags()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list repo tags")
+	}
+	err = iter.ForEach(func(ref *plumbing.Reference) error {
+		hash := ref.Hash()
+		if annotated, err := repo.TagObject(hash); err == nil {
+			commit, err := annotated.Commit()
+			if err != nil {
+				return err
+			}
+			hash = commit.Hash
+		}
+		tags = append(tags, tag{ref.Name().Short(), hash.String()})
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list repo tags")
+	}
+	return tags, nil
+}
+
+// file reads a single file from a repository at the given ref
+func (l *LocalScraper) file(ctx context.Context, meta versioning.DependencyMeta, ref, path string) (contents []byte, found bool, err error) {
+	repo, err := l.open(meta)
+	if err != nil {
+		return
+	}
+
+	hash, err := repo.ResolveRevision(plumbing.Revision(ref))
+	if err != nil {
+		return nil, false, errors.Wrapf(err, "failed to resolve %s", ref)
+	}
+	commit, err := repo.CommitObject(*hash)
+	if err != nil {
+		return
+	}
+
+	f, err := commit.File(path)
+	if err == object.ErrFileNotFound {
+		return nil, false, nil
+	} else if err != nil {
+		return
+	}
+
+	r, err := f.Reader()
+	if err != nil {
+		return
+	}
+	defer r.Close()
+
+	contents, err = ioutil.ReadAll(r)
+	if err != nil {
+		return
+	}
+	return contents, true, nil
+}
@@ -0,0 +1,127 @@
+package scraper_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Southclaws/sampctl/pawnpackage"
+	"github.com/Southclaws/sampctl/versioning"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+
+	"github.com/Southclaws/pawndex/pawn"
+	"github.com/Southclaws/pawndex/scraper"
+)
+
+var committed = time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+
+// initRepo creates a working copy with the given files committed to master and the given tags
+// pointing at that commit
+func initRepo(t *testing.T, path string, files map[string]string, tags ...string) {
+	repo, err := git.PlainInit(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wt, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, contents := range files {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(path, name)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(path, name), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := wt.Add(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sig := &object.Signature{Name: "test", Email: "test@example.com", When: committed}
+	hash, err := wt.Commit("initial", &git.CommitOptions{Author: sig, Committer: sig})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tag := range tags {
+		if _, err := repo.CreateTag(tag, hash, &git.CreateTagOptions{Tagger: sig, Message: tag}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestLocalScraper_Scrape(t *testing.T) {
+	root, err := ioutil.TempDir("", "pawndex")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	initRepo(t, filepath.Join(root, "test", "full"), map[string]string{
+		"pawn.json": `{"user":"test","repo":"full"}`,
+		"full.inc":  "native Full();\n",
+	}, "1.0.0")
+	initRepo(t, filepath.Join(root, "test", "buried-src"), map[string]string{
+		"src/buried.inc": "stock Buried() {}\n",
+	})
+	if _, err := git.PlainClone(filepath.Join(root, "test", "bare.git"), true, &git.CloneOptions{
+		URL: filepath.Join(root, "test", "buried-src"),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	s := scraper.LocalScraper{Root: root, Site: "local"}
+
+	tests := []struct {
+		name        string
+		wantPkg     *pawn.Package
+		wantSymbols []string
+		wantErr     bool
+	}{
+		{"local/test/full", &pawn.Package{
+			Package: pawnpackage.Package{
+				DependencyMeta: versioning.DependencyMeta{Site: "local", User: "test", Repo: "full"},
+			},
+			Classification: pawn.ClassificationPawnPackage,
+			Updated:        committed,
+			Tags:           []string{"1.0.0"},
+			Includes:       []string{"full.inc"},
+		}, []string{"Full", "Full@1.0.0"}, false},
+		{"local/test/bare", &pawn.Package{
+			Package: pawnpackage.Package{
+				DependencyMeta: versioning.DependencyMeta{Site: "local", User: "test", Repo: "bare"},
+			},
+			Classification: pawn.ClassificationBuried,
+			Updated:        committed,
+			Includes:       []string{"src/buried.inc"},
+		}, []string{"Buried"}, false},
+		{"local/test/missing", nil, nil, true},
+		{"local/../test", nil, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotPkg, err := s.Scrape(context.Background(), tt.name)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("LocalScraper.Scrape() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			var gotSymbols []string
+			if gotPkg != nil {
+				gotSymbols = symbolNames(gotPkg.Symbols)
+				gotPkg.Symbols, gotPkg.Commits = nil, nil
+				gotPkg.Versions = nil
+			}
+			if !reflect.DeepEqual(gotPkg, tt.wantPkg) {
+				t.Errorf("LocalScraper.Scrape() = %#v, want %#v", gotPkg, tt.wantPkg)
+			}
+			if !reflect.DeepEqual(gotSymbols, tt.wantSymbols) {
+				t.Errorf("LocalScraper.Scrape() symbols = %v, want %v", gotSymbols, tt.wantSymbols)
+			}
+		})
+	}
+}
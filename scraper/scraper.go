@@ -1,19 +1,14 @@
 package scraper
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
-	"fmt"
-	"io/ioutil"
-	"net/http"
 	"path/filepath"
-	"strings"
+	"sync"
 	"time"
 
 	"github.com/Southclaws/sampctl/pawnpackage"
 	"github.com/Southclaws/sampctl/versioning"
-	"github.com/google/go-github/github"
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
 	"gopkg.in/yaml.v2"
@@ -21,6 +16,14 @@ import (
 	"github.com/Southclaws/pawndex/pawn"
 )
 
+const (
+	// maxSymbolFiles limits how many include files of a single commit are downloaded to index
+	// symbols from, large frameworks are still mostly covered.
+	maxSymbolFiles = 1000
+	// symbolWorkers is the number of include files of a commit downloaded at once
+	symbolWorkers = 8
+)
+
 // Scraper is responsible for taking a repo and checking its contents for the qualifying
 // properties of a Pawn Package. This includes the presence of one or more .inc files and optionally
 // a pawn.json or pawn.yaml file. If one of these files exists, additional information is extracted.
@@ -28,154 +31,354 @@ type Scraper interface {
 	Scrape(context.Context, string) (*pawn.Package, error)
 }
 
-type GitHubScraper struct {
-	GitHub *github.Client
+// ErrNotFound is returned when a repository doesn't exist, or isn't visible to the scraper
+var ErrNotFound = errors.New("repository not found")
+
+// errNoDefinition is returned when there's no valid package definition at a ref, either none at all
+// or one that can't be parsed, as opposed to failing to read it
+var errNoDefinition = errors.New("package does not point to a valid remote package")
+
+// Index tells a scrape what of a repository is already indexed, storage.DB implements it
+type Index interface {
+	// GetIndexedCommits returns the commit each tag of a package was indexed at, with the default
+	// branch under an empty tag
+	GetIndexedCommits(name string) (map[string]string, error)
+}
+
+// Checker is implemented by Scrapers that can look up a repository without scraping it
+type Checker interface {
+	// Lookup returns the canonical name of a repository, as the host spells it, or exists is false
+	// if the repository doesn't exist
+	Lookup(ctx context.Context, name string) (canonical string, exists bool, err error)
+}
+
+// source is implemented by each host a Scraper can read repositories from, scrape uses it to
+// build packages the same way regardless of where the repository lives.
+type source interface {
+	// repository returns the metadata of the repository with the given user and repo, or
+	// ErrNotFound if it doesn't exist
+	repository(ctx context.Context, meta versioning.DependencyMeta) (repository, error)
+	// head returns the commit SHA at the head of a branch
+	head(ctx context.Context, meta versioning.DependencyMeta, branch string) (sha string, err error)
+	// tree returns the path of every file in the tree of a commit
+	tree(ctx context.Context, meta versioning.DependencyMeta, sha string) (paths []string, err error)
+	// tags lists every tag in the repository
+	tags(ctx context.Context, meta versioning.DependencyMeta) ([]tag, error)
+	// file downloads a single file at a ref, found is false if it doesn't exist
+	file(ctx context.Context, meta versioning.DependencyMeta, ref, path string) (contents []byte, found bool, err error)
+}
+
+// repository is the host independent metadata of a repository
+type repository struct {
+	meta          versioning.DependencyMeta // canonical site, user and repo
+	description   string
+	stars         int
+	updated       time.Time
+	topics        []string
+	defaultBranch string
+	archived      bool
 }
 
-func (g *GitHubScraper) Scrape(ctx context.Context, name string) (*pawn.Package, error) {
-	splitname := strings.Split(name, "/")
+// tag is a git tag and the commit it points to
+type tag struct {
+	name string
+	sha  string
+}
 
-	repo, _, err := g.GitHub.Repositories.Get(ctx, splitname[0], splitname[1])
+// scrape reads a repository as a package. Tags that index says are indexed at the commit they
+// point to aren't read again, nor is the default branch if it hasn't moved.
+func scrape(ctx context.Context, src source, index Index, name string) (*pawn.Package, error) {
+	target, err := pawn.ParseName(name)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to get repo metadata from github")
+		return nil, err
 	}
 
-	meta := versioning.DependencyMeta{
-		User: repo.Owner.GetLogin(),
-		Repo: repo.GetName(),
+	repo, err := src.repository(ctx, target)
+	if err != nil {
+		return nil, err
 	}
+	meta := repo.meta
 
 	if meta.User == "" || meta.Repo == "" {
 		return nil, errors.New("repository details empty")
 	}
 
 	var processedPackage pawn.Package // the result - a package with some additional metadata
-	pkg, err := packageFromRepo(repo, meta)
+	sha, sourceErr := src.head(ctx, meta, repo.defaultBranch)
+	var paths []string
+	if sourceErr == nil {
+		paths, sourceErr = src.tree(ctx, meta, sha)
+	}
+	classification, includes := findPawnSource(paths)
+	pkg, err := packageFromRepo(ctx, src, meta, repo.defaultBranch)
+	if err != nil && errors.Cause(err) != errNoDefinition {
+		return nil, errors.Wrap(err, "failed to read package definition")
+	}
 	if err != nil {
-		processedPackage, err = g.findPawnSource(ctx, repo, meta)
-		if err != nil {
-			return nil, err
+		if sourceErr != nil {
+			return nil, sourceErr
+		}
+		processedPackage = pawn.Package{
+			Package:        pawnpackage.Package{DependencyMeta: meta},
+			Classification: classification,
 		}
 	} else {
+		if sourceErr != nil {
+			zap.L().Warn("failed to walk source tree of package",
+				zap.String("meta", meta.String()), zap.Error(sourceErr))
+		}
 		processedPackage = pawn.Package{
 			Package:        pkg,
 			Classification: pawn.ClassificationPawnPackage,
 		}
 	}
+	processedPackage.Includes = includes
 
-	if processedPackage.User == "" {
-		processedPackage.User = meta.User
-	}
-	if processedPackage.Repo == "" {
-		processedPackage.Repo = meta.Repo
-	}
+	// the package is named as the host names the repository, a fork keeps its upstream's user and
+	// repo in its definition and must not be stored over it
+	processedPackage.Site = meta.Site
+	processedPackage.User = meta.User
+	processedPackage.Repo = meta.Repo
 
 	if processedPackage.Classification == pawn.ClassificationInvalid {
 		return nil, nil
 	}
 
 	// add some generic info
-	processedPackage.Stars = repo.GetStargazersCount()
-	processedPackage.Updated = repo.GetUpdatedAt().Time
-	processedPackage.Topics = repo.Topics
+	processedPackage.Description = repo.description
+	processedPackage.Stars = repo.stars
+	processedPackage.Updated = repo.updated
+	processedPackage.Topics = repo.topics
+	processedPackage.Archived = repo.archived
+	processedPackage.Requires = pawn.ParseDependencies(processedPackage.GetAllDependencies())
 
-	tags, _, err := g.GitHub.Repositories.ListTags(ctx, meta.User, meta.Repo, nil)
+	tags, err := src.tags(ctx, meta)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to list repo tags")
+		return nil, err
+	}
+	for _, tag := range tags {
+		processedPackage.Tags = append(processedPackage.Tags, tag.name)
+	}
+
+	indexed := map[string]string{}
+	if index != nil {
+		if indexed, err = index.GetIndexedCommits(processedPackage.String()); err != nil {
+			return nil, errors.Wrap(err, "failed to get indexed commits")
+		}
+	}
+	r := &reader{ctx: ctx, src: src, meta: meta, symbols: map[string][]pawn.Symbol{}}
+	processedPackage.Commits = map[string]string{}
+
+	// what couldn't be read again keeps the commit it was indexed at, so it's kept as it was
+	keep := func(tag string) {
+		if commit, ok := indexed[tag]; ok {
+			processedPackage.Commits[tag] = commit
+		}
+	}
+
+	switch {
+	case sourceErr != nil:
+		keep("")
+	case indexed[""] == sha:
+		processedPackage.Commits[""] = sha
+	default:
+		symbols, err := r.symbolsAt(sha, includes)
+		if err != nil {
+			zap.L().Warn("failed to read symbols of default branch",
+				zap.String("meta", meta.String()), zap.Error(err))
+			keep("")
+			break
+		}
+		processedPackage.Commits[""] = sha
+		processedPackage.Symbols = append(processedPackage.Symbols, symbols...)
 	}
+
 	for _, tag := range tags {
-		processedPackage.Tags = append(processedPackage.Tags, tag.GetName())
+		if indexed[tag.name] == tag.sha {
+			processedPackage.Commits[tag.name] = tag.sha
+			continue
+		}
+		version, symbols, err := r.tag(tag)
+		if err != nil {
+			zap.L().Warn("failed to read tag",
+				zap.String("meta", meta.String()), zap.String("tag", tag.name), zap.Error(err))
+			keep(tag.name)
+			continue
+		}
+		processedPackage.Commits[tag.name] = tag.sha
+		if version != nil {
+			processedPackage.Versions = append(processedPackage.Versions, *version)
+		}
+		processedPackage.Symbols = append(processedPackage.Symbols, symbols...)
 	}
 
 	return &processedPackage, nil
 }
 
-// packageFromRepo attempts to get a package from the given package definition's public repo
-func packageFromRepo(
-	repo *github.Repository,
-	meta versioning.DependencyMeta,
-) (pkg pawnpackage.Package, err error) {
-	client := http.Client{Timeout: time.Second * 10}
-	body := bytes.NewBuffer(nil)
-
-	request, err := http.NewRequest(http.MethodGet, fmt.Sprintf(
-		"https://raw.githubusercontent.com/%s/%s/%s/pawn.json",
-		meta.User, meta.Repo, *repo.DefaultBranch,
-	), body)
+// lookup looks up a repository's canonical name
+func lookup(ctx context.Context, src source, name string) (canonical string, exists bool, err error) {
+	target, err := pawn.ParseName(name)
 	if err != nil {
-		return
+		return "", false, err
+	}
+	repo, err := src.repository(ctx, target)
+	if errors.Cause(err) == ErrNotFound {
+		return "", false, nil
+	} else if err != nil {
+		return "", false, err
 	}
+	return pawn.Name(repo.meta.Site, repo.meta.User, repo.meta.Repo), true, nil
+}
 
-	resp, err := client.Do(request)
+// packageFromRepo attempts to get a package from the given package definition's public repo at
+// the given ref, which may be a branch, tag or commit SHA
+func packageFromRepo(
+	ctx context.Context,
+	src source,
+	meta versioning.DependencyMeta,
+	ref string,
+) (pkg pawnpackage.Package, err error) {
+	contents, found, err := src.file(ctx, meta, ref, "pawn.json")
 	if err != nil {
 		return
 	}
-	if resp.StatusCode == 200 {
-		var contents []byte
-		contents, err = ioutil.ReadAll(resp.Body)
-		if err != nil {
-			return
+	if found {
+		if err = json.Unmarshal(contents, &pkg); err != nil {
+			err = errors.Wrapf(errNoDefinition, "invalid pawn.json: %v", err)
 		}
-		err = json.Unmarshal(contents, &pkg)
 		return
 	}
 
 	zap.L().Debug("repo does not contain a pawn.json",
-		zap.String("meta", meta.String()))
+		zap.String("meta", meta.String()), zap.String("ref", ref))
 
-	resp, err = http.Get(fmt.Sprintf(
-		"https://raw.githubusercontent.com/%s/%s/%s/pawn.yaml",
-		meta.User, meta.Repo, *repo.DefaultBranch,
-	))
+	contents, found, err = src.file(ctx, meta, ref, "pawn.yaml")
 	if err != nil {
 		return
 	}
-	if resp.StatusCode == 200 {
-		var contents []byte
-		contents, err = ioutil.ReadAll(resp.Body)
-		if err != nil {
-			return
+	if found {
+		if err = yaml.Unmarshal(contents, &pkg); err != nil {
+			err = errors.Wrapf(errNoDefinition, "invalid pawn.yaml: %v", err)
 		}
-		err = yaml.Unmarshal(contents, &pkg)
 		return
 	}
 
 	zap.L().Debug("repo does not contain a pawn.yaml",
-		zap.String("meta", meta.String()))
+		zap.String("meta", meta.String()), zap.String("ref", ref))
 
-	return pkg, errors.New("package does not point to a valid remote package")
+	return pkg, errNoDefinition
 }
 
-func (g *GitHubScraper) findPawnSource(ctx context.Context, repo *github.Repository,
-	meta versioning.DependencyMeta) (pkg pawn.Package, err error) {
-	ref, _, err := g.GitHub.Git.GetRef(ctx, meta.User, meta.Repo,
-		fmt.Sprintf("heads/%s", repo.GetDefaultBranch()))
-	if err != nil {
-		err = errors.Wrap(err, "failed to get HEAD ref from default branch")
-		return
+// reader reads the tags of a repository during a scrape, the symbols of each commit are only read
+// once when several tags point to it
+type reader struct {
+	ctx     context.Context
+	src     source
+	meta    versioning.DependencyMeta
+	symbols map[string][]pawn.Symbol // by commit
+}
+
+// tag reads the package definition and symbols at a tag, version is nil if it has no valid
+// definition
+func (r *reader) tag(t tag) (version *pawnpackage.Package, symbols []pawn.Symbol, err error) {
+	pkg, err := packageFromRepo(r.ctx, r.src, r.meta, t.sha)
+	if err == nil {
+		pkg.Site = r.meta.Site
+		pkg.User = r.meta.User
+		pkg.Repo = r.meta.Repo
+		pkg.Tag = t.name
+		pkg.Commit = t.sha
+		version = &pkg
+	} else if errors.Cause(err) != errNoDefinition {
+		return nil, nil, err
+	} else {
+		zap.L().Debug("no package definition at tag",
+			zap.String("meta", r.meta.String()), zap.String("tag", t.name), zap.Error(err))
 	}
 
-	sha := ref.GetObject().GetSHA()
-	tree, _, err := g.GitHub.Git.GetTree(ctx, meta.User, meta.Repo, sha, true)
+	paths, err := r.src.tree(r.ctx, r.meta, t.sha)
 	if err != nil {
-		err = errors.Wrap(err, "failed to get git tree")
-		return
+		return nil, nil, err
+	}
+	_, includes := findPawnSource(paths)
+	found, err := r.symbolsAt(t.sha, includes)
+	if err != nil {
+		return nil, nil, err
 	}
+	for _, symbol := range found {
+		symbol.Tag = t.name
+		symbols = append(symbols, symbol)
+	}
+	return version, symbols, nil
+}
 
-	pkg = pawn.Package{Package: pawnpackage.Package{DependencyMeta: meta}}
+// symbolsAt downloads each include file at the given commit and extracts the symbols it declares,
+// without a tag. It fails if any of the files can't be downloaded, so the commit is read again
+// rather than indexed with symbols missing.
+func (r *reader) symbolsAt(sha string, includes []string) ([]pawn.Symbol, error) {
+	if symbols, ok := r.symbols[sha]; ok {
+		return symbols, nil
+	}
 
-	for _, file := range tree.Entries {
-		ext := filepath.Ext(file.GetPath())
-		if ext == ".inc" || ext == ".pwn" {
-			if filepath.Dir(file.GetPath()) == "." {
-				pkg.Classification = pawn.ClassificationBarebones
-				break
-			} else {
-				pkg.Classification = pawn.ClassificationBuried
-				// no break, keep searching
+	if len(includes) > maxSymbolFiles {
+		zap.L().Debug("too many include files, only indexing symbols for some",
+			zap.String("meta", r.meta.String()), zap.Int("includes", len(includes)))
+		includes = includes[:maxSymbolFiles]
+	}
+
+	found := make([][]pawn.Symbol, len(includes))
+	errs := make([]error, len(includes))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < symbolWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				contents, ok, err := r.src.file(r.ctx, r.meta, sha, includes[i])
+				if err != nil {
+					errs[i] = errors.Wrapf(err, "failed to get include file %s", includes[i])
+					continue
+				}
+				if ok {
+					found[i] = pawn.ParseSymbols(includes[i], contents)
+				}
 			}
+		}()
+	}
+	for i := range includes {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	var symbols []pawn.Symbol
+	for i := range includes {
+		if errs[i] != nil {
+			return nil, errs[i]
 		}
+		symbols = append(symbols, found[i]...)
 	}
+	r.symbols[sha] = symbols
+	return symbols, nil
+}
 
+// findPawnSource classifies a repository based on where its Pawn source files are in its tree, it
+// also returns the path of every include file.
+func findPawnSource(paths []string) (classification pawn.Classification, includes []string) {
+	classification = pawn.ClassificationInvalid
+	for _, path := range paths {
+		ext := filepath.Ext(path)
+		if ext == ".inc" {
+			includes = append(includes, path)
+		}
+		if ext == ".inc" || ext == ".pwn" {
+			if filepath.Dir(path) == "." {
+				classification = pawn.ClassificationBarebones
+			} else if classification != pawn.ClassificationBarebones {
+				classification = pawn.ClassificationBuried
+			}
+		}
+	}
 	return
 }
@@ -2,34 +2,324 @@ package scraper_test
 
 import (
 	"context"
-	"fmt"
-	"os"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/Southclaws/sampctl/pawnpackage"
+	"github.com/Southclaws/sampctl/versioning"
+
+	"github.com/Southclaws/pawndex/githubtest"
+	"github.com/Southclaws/pawndex/pawn"
 	"github.com/Southclaws/pawndex/scraper"
-	"github.com/google/go-github/github"
-	"github.com/joho/godotenv"
-	"golang.org/x/oauth2"
 )
 
 func TestGitHubScraper_Scrape(t *testing.T) {
-	godotenv.Load("../.env")
-	token := os.Getenv("PAWNDEX_GITHUBTOKEN")
-	if token == "" {
-		panic("tests need a token to run.")
+	pushed := time.Date(2020, 7, 1, 0, 0, 0, 0, time.UTC)
+
+	server := githubtest.NewServer(
+		githubtest.Repository{
+			Owner: "Southclaws", Name: "samp-logger",
+			Description: "Structured logging", Stars: 12, Updated: pushed,
+			Topics: []string{"pawn-package"},
+			Files: map[string]string{
+				"pawn.json":  `{"user":"Southclaws","repo":"samp-logger","dependencies":["pawn-lang/samp-stdlib"]}`,
+				"logger.inc": "stock Logger_Log(const text[]) {}\n",
+			},
+			Tags: []githubtest.Tag{
+				{Name: "1.0.0", Files: map[string]string{"pawn.json": `{"user":"Southclaws","repo":"samp-logger"}`}},
+				{Name: "0.1.0", Files: map[string]string{"README.md": "no definition yet"}},
+			},
+		},
+		githubtest.Repository{
+			Owner: "test", Name: "yaml", Updated: pushed,
+			Files: map[string]string{
+				"pawn.yaml":    "user: test\nrepo: yaml\nentry: test.pwn\n",
+				"src/yaml.inc": "native Yaml();\n",
+			},
+		},
+		githubtest.Repository{
+			Owner: "test", Name: "basic", Updated: pushed, Archived: true,
+			Files: map[string]string{"basic.inc": "", "test/test.pwn": ""},
+		},
+		githubtest.Repository{
+			Owner: "test", Name: "buried", Updated: pushed,
+			Files: map[string]string{"pawno/include/buried.inc": ""},
+		},
+		githubtest.Repository{
+			Owner: "test", Name: "escaped", Updated: pushed,
+			Files: map[string]string{"my includes/#1.inc": "native Escaped();\n"},
+		},
+		githubtest.Repository{
+			Owner: "bob", Name: "logger", Updated: pushed,
+			Files: map[string]string{
+				"pawn.json":  `{"user":"Southclaws","repo":"samp-logger"}`,
+				"logger.inc": "",
+			},
+		},
+		githubtest.Repository{
+			Owner: "test", Name: "none", Updated: pushed,
+			Files: map[string]string{"README.md": ""},
+		},
+	)
+	defer server.Close()
+
+	scrapers := []struct {
+		name    string
+		scraper scraper.GitHubScraper
+	}{
+		{"raw", scraper.GitHubScraper{GitHub: server.GitHub(), RawURL: server.RawURL()}},
+		{"contents", scraper.GitHubScraper{GitHub: server.GitHub()}},
 	}
 
-	s := scraper.GitHubScraper{
-		GitHub: github.NewClient(
-			oauth2.NewClient(
-				context.Background(),
-				oauth2.StaticTokenSource(&oauth2.Token{
-					AccessToken: token,
-				}),
-			)),
+	meta := func(user, repo string) versioning.DependencyMeta {
+		return versioning.DependencyMeta{Site: "github.com", User: user, Repo: repo}
 	}
+	tests := []struct {
+		name         string
+		wantPkg      *pawn.Package
+		wantVersions []string
+		wantSymbols  []string
+		wantErr      bool
+	}{
+		{"Southclaws/samp-logger", &pawn.Package{
+			Package: pawnpackage.Package{
+				DependencyMeta: meta("Southclaws", "samp-logger"),
+				Dependencies:   []versioning.DependencyString{"pawn-lang/samp-stdlib"},
+			},
+			Classification: pawn.ClassificationPawnPackage,
+			Description:    "Structured logging",
+			Stars:          12,
+			Updated:        pushed,
+			Topics:         []string{"pawn-package"},
+			Tags:           []string{"1.0.0", "0.1.0"},
+			Includes:       []string{"logger.inc"},
+			Requires:       []versioning.DependencyMeta{meta("pawn-lang", "samp-stdlib")},
+		}, []string{"1.0.0"}, []string{"Logger_Log"}, false},
+		{"github.com/test/yaml", &pawn.Package{
+			Package: pawnpackage.Package{
+				DependencyMeta: meta("test", "yaml"),
+				Entry:          "test.pwn",
+			},
+			Classification: pawn.ClassificationPawnPackage,
+			Updated:        pushed,
+			Topics:         []string{},
+			Includes:       []string{"src/yaml.inc"},
+		}, nil, []string{"Yaml"}, false},
+		{"test/basic", &pawn.Package{
+			Package:        pawnpackage.Package{DependencyMeta: meta("test", "basic")},
+			Classification: pawn.ClassificationBarebones,
+			Updated:        pushed,
+			Topics:         []string{},
+			Includes:       []string{"basic.inc"},
+			Archived:       true,
+		}, nil, nil, false},
+		{"test/buried", &pawn.Package{
+			Package:        pawnpackage.Package{DependencyMeta: meta("test", "buried")},
+			Classification: pawn.ClassificationBuried,
+			Updated:        pushed,
+			Topics:         []string{},
+			Includes:       []string{"pawno/include/buried.inc"},
+		}, nil, nil, false},
+		{"test/escaped", &pawn.Package{
+			Package:        pawnpackage.Package{DependencyMeta: meta("test", "escaped")},
+			Classification: pawn.ClassificationBuried,
+			Updated:        pushed,
+			Topics:         []string{},
+			Includes:       []string{"my includes/#1.inc"},
+		}, nil, []string{"Escaped"}, false},
+		// a fork still has its upstream's definition but is named as the host names it
+		{"bob/logger", &pawn.Package{
+			Package:        pawnpackage.Package{DependencyMeta: meta("bob", "logger")},
+			Classification: pawn.ClassificationPawnPackage,
+			Updated:        pushed,
+			Topics:         []string{},
+			Includes:       []string{"logger.inc"},
+		}, nil, nil, false},
+		{"test/none", nil, nil, nil, false},
+		{"test/missing", nil, nil, nil, true},
+	}
+	for _, s := range scrapers {
+		for _, tt := range tests {
+			t.Run(s.name+"/"+tt.name, func(t *testing.T) {
+				gotPkg, err := s.scraper.Scrape(context.Background(), tt.name)
+				if (err != nil) != tt.wantErr {
+					t.Errorf("GitHubScraper.Scrape() error = %v, wantErr %v", err, tt.wantErr)
+					return
+				}
 
+				var gotVersions, gotSymbols []string
+				if gotPkg != nil {
+					for _, v := range gotPkg.Versions {
+						gotVersions = append(gotVersions, v.Tag)
+					}
+					gotSymbols = symbolNames(gotPkg.Symbols)
+					gotPkg.Versions, gotPkg.Symbols, gotPkg.Commits = nil, nil, nil
+				}
+				if !reflect.DeepEqual(gotPkg, tt.wantPkg) {
+					t.Errorf("GitHubScraper.Scrape() = %#v, want %#v", gotPkg, tt.wantPkg)
+				}
+				if !reflect.DeepEqual(gotVersions, tt.wantVersions) {
+					t.Errorf("GitHubScraper.Scrape() versions = %v, want %v", gotVersions, tt.wantVersions)
+				}
+				if !reflect.DeepEqual(gotSymbols, tt.wantSymbols) {
+					t.Errorf("GitHubScraper.Scrape() symbols = %v, want %v", gotSymbols, tt.wantSymbols)
+				}
+			})
+		}
+	}
+}
+
+func TestGitHubScraper_rawFailure(t *testing.T) {
+	server := githubtest.NewServer(githubtest.Repository{
+		Owner: "Southclaws", Name: "samp-logger",
+		Files: map[string]string{
+			"pawn.json":  `{"user":"Southclaws","repo":"samp-logger"}`,
+			"logger.inc": "stock Logger_Log(const text[]) {}\n",
+		},
+	})
+	defer server.Close()
+
+	// the raw host fails for include files, or for everything once down is set
+	down := false
+	raw := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down || strings.HasSuffix(r.URL.Path, ".inc") {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		http.Redirect(w, r, server.RawURL()+strings.TrimPrefix(r.URL.Path, "/"), http.StatusFound)
+	}))
+	defer raw.Close()
+
+	s := scraper.GitHubScraper{GitHub: server.GitHub(), RawURL: raw.URL + "/"}
+
+	// an include that fails to download leaves the head unindexed, so it's read again next time
 	pkg, err := s.Scrape(context.Background(), "Southclaws/samp-logger")
-	fmt.Println(err)
-	fmt.Printf("%#v\n", pkg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pkg.Classification != pawn.ClassificationPawnPackage || pkg.Symbols != nil || len(pkg.Commits) != 0 {
+		t.Errorf("Scrape() = %s with symbols %v at commits %v, want a package with the head unindexed",
+			pkg.Classification, pkg.Symbols, pkg.Commits)
+	}
+
+	// a definition that fails to download fails the scrape rather than indexing it without one
+	down = true
+	if pkg, err := s.Scrape(context.Background(), "Southclaws/samp-logger"); err == nil {
+		t.Errorf("Scrape() = %v, want an error", pkg)
+	}
+}
+
+// commitIndex is an Index of the commits each package was last indexed at
+type commitIndex map[string]map[string]string
+
+func (c commitIndex) GetIndexedCommits(name string) (map[string]string, error) {
+	return c[name], nil
+}
+
+func TestGitHubScraper_index(t *testing.T) {
+	server := githubtest.NewServer(githubtest.Repository{
+		Owner: "Southclaws", Name: "samp-logger",
+		Files: map[string]string{
+			"pawn.json":  `{"user":"Southclaws","repo":"samp-logger"}`,
+			"logger.inc": "stock Logger_Log(const text[]) {}\n",
+		},
+		Tags: []githubtest.Tag{{Name: "1.0.0", Files: map[string]string{
+			"pawn.json": `{"user":"Southclaws","repo":"samp-logger"}`,
+			"old.inc":   "native Old();\n",
+		}}},
+	})
+	defer server.Close()
+
+	index := commitIndex{}
+	s := scraper.GitHubScraper{GitHub: server.GitHub(), Index: index}
+	const name = "github.com/Southclaws/samp-logger"
+
+	// symbols of a tag come from its own tree
+	first, err := s.Scrape(context.Background(), name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := symbolNames(first.Symbols), []string{"Logger_Log", "Old@1.0.0"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("first scrape symbols = %v, want %v", got, want)
+	}
+	if len(first.Versions) != 1 || len(first.Commits) != 2 {
+		t.Errorf("first scrape read versions %v at commits %v, want the tag and head", first.Versions, first.Commits)
+	}
+	requests, _ := server.Requests()
+
+	// nothing indexed at the same commit is read again
+	index[name] = first.Commits
+	second, err := s.Scrape(context.Background(), name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.Symbols != nil || second.Versions != nil || !reflect.DeepEqual(second.Commits, first.Commits) {
+		t.Errorf("second scrape = symbols %v, versions %v at commits %v, want only commits %v",
+			second.Symbols, second.Versions, second.Commits, first.Commits)
+	}
+	total, _ := server.Requests()
+	if total-requests >= requests {
+		t.Errorf("second scrape made %d requests, want fewer than the first %d", total-requests, requests)
+	}
+
+	// a tag indexed at another commit has moved so it's read again
+	index[name] = map[string]string{"": first.Commits[""], "1.0.0": "moved"}
+	third, err := s.Scrape(context.Background(), name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := symbolNames(third.Symbols), []string{"Old@1.0.0"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("third scrape symbols = %v, want %v", got, want)
+	}
+	if !reflect.DeepEqual(third.Commits, first.Commits) {
+		t.Errorf("third scrape commits = %v, want %v", third.Commits, first.Commits)
+	}
+}
+
+// symbolNames returns the name of each symbol, followed by its tag if it's from one
+func symbolNames(symbols []pawn.Symbol) (names []string) {
+	for _, s := range symbols {
+		if s.Tag != "" {
+			names = append(names, s.Name+"@"+s.Tag)
+		} else {
+			names = append(names, s.Name)
+		}
+	}
+	return
+}
+
+func TestHosts_Lookup(t *testing.T) {
+	server := githubtest.NewServer(githubtest.Repository{Owner: "Southclaws", Name: "samp-logger"})
+	defer server.Close()
+
+	hosts := scraper.Hosts{pawn.DefaultSite: &scraper.GitHubScraper{GitHub: server.GitHub()}}
+
+	tests := []struct {
+		name          string
+		wantCanonical string
+		wantExists    bool
+		wantErr       bool
+	}{
+		{"Southclaws/samp-logger", "github.com/Southclaws/samp-logger", true, false},
+		{"southclaws/SAMP-LOGGER", "github.com/Southclaws/samp-logger", true, false},
+		{"Southclaws/missing", "", false, false},
+		{"codeberg.org/Southclaws/samp-logger", "", false, false},
+		{"samp-logger", "", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			canonical, exists, err := hosts.Lookup(context.Background(), tt.name)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Hosts.Lookup() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if canonical != tt.wantCanonical || exists != tt.wantExists {
+				t.Errorf("Hosts.Lookup() = %v, %v, want %v, %v", canonical, exists, tt.wantCanonical, tt.wantExists)
+			}
+		})
+	}
 }
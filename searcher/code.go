@@ -0,0 +1,74 @@
+package searcher
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/Southclaws/pawndex/pawn"
+)
+
+// GitHubCodeSearcher finds repositories through GitHub code search, such as `filename:pawn.json`,
+// so repositories with a package definition are found regardless of their topics or detected
+// language. Code search can't be split by date like repository search, so results past the first
+// 1000 are reported as missed.
+type GitHubCodeSearcher struct {
+	GitHub *github.Client
+	Site   string // host packages are named with, defaults to github.com
+
+	coverageLog
+}
+
+func (g *GitHubCodeSearcher) Search(queries ...string) ([]string, error) {
+	var repos []string
+	seen := map[string]bool{}
+	for _, q := range queries {
+		coverage := pawn.SearchCoverage{Site: g.site(), Query: q, Time: time.Now().UTC(), Slices: 1}
+		found := map[string]bool{}
+
+		page := 1
+		for {
+			result, _, err := g.GitHub.Search.Code(context.Background(), q, &github.SearchOptions{
+				ListOptions: github.ListOptions{Page: page, PerPage: searchPageSize},
+			})
+			if err != nil {
+				zap.L().Warn("code search failed", zap.String("query", q), zap.Error(errors.Wrap(err, "failed to search code")))
+				coverage.Failed++
+				break
+			}
+			coverage.Total = result.GetTotal()
+
+			for _, r := range result.CodeResults {
+				name := pawn.Name(g.site(), r.Repository.GetOwner().GetLogin(), r.Repository.GetName())
+				found[name] = true
+				if !seen[name] {
+					seen[name] = true
+					repos = append(repos, name)
+				}
+			}
+			if len(result.CodeResults) == 0 || page*searchPageSize >= maxSearchResults ||
+				page*searchPageSize >= coverage.Total {
+				break
+			}
+			page++
+		}
+
+		coverage.Found = len(found)
+		if coverage.Total > maxSearchResults {
+			coverage.Truncated = 1
+			coverage.Missed = coverage.Total - maxSearchResults
+		}
+		g.setCoverage(coverage)
+	}
+	return repos, nil
+}
+
+func (g *GitHubCodeSearcher) site() string {
+	if g.Site == "" {
+		return pawn.DefaultSite
+	}
+	return g.Site
+}
@@ -0,0 +1,52 @@
+package searcher_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Southclaws/pawndex/githubtest"
+	"github.com/Southclaws/pawndex/searcher"
+)
+
+func TestGitHubCodeSearcher_Search(t *testing.T) {
+	server := githubtest.NewServer(
+		githubtest.Repository{Owner: "test", Name: "json", Files: map[string]string{"pawn.json": "{}"}},
+		githubtest.Repository{Owner: "test", Name: "yaml", Files: map[string]string{"pawn.yaml": ""}},
+		githubtest.Repository{Owner: "test", Name: "nested", Files: map[string]string{
+			"pawn.json":          "{}",
+			"examples/pawn.json": "{}",
+		}},
+		githubtest.Repository{Owner: "test", Name: "none", Files: map[string]string{"test.inc": ""}},
+	)
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		queries []string
+		want    []string
+	}{
+		{"json", []string{"filename:pawn.json"}, []string{"github.com/test/json", "github.com/test/nested"}},
+		{"both", []string{"filename:pawn.json", "filename:pawn.yaml"}, []string{
+			"github.com/test/json",
+			"github.com/test/nested",
+			"github.com/test/yaml",
+		}},
+		{"none", []string{"filename:pawn.toml"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := searcher.GitHubCodeSearcher{GitHub: server.GitHub()}
+			got, err := s.Search(tt.queries...)
+			if err != nil {
+				t.Errorf("GitHubCodeSearcher.Search() error = %v", err)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GitHubCodeSearcher.Search() = %v, want %v", got, tt.want)
+			}
+			if coverage := s.Coverage(); len(coverage) != len(tt.queries) {
+				t.Errorf("GitHubCodeSearcher.Coverage() = %v, want one per query", coverage)
+			}
+		})
+	}
+}
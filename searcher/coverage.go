@@ -0,0 +1,52 @@
+package searcher
+
+import (
+	"sync"
+
+	"go.uber.org/zap"
+
+	"github.com/Southclaws/pawndex/pawn"
+)
+
+// CoverageReporter is implemented by Searchers that can describe how complete their last search of
+// each query was
+type CoverageReporter interface {
+	Coverage() []pawn.SearchCoverage
+}
+
+// coverageLog keeps the coverage of the last search of each query, Searchers embed it to
+// implement CoverageReporter
+type coverageLog struct {
+	mu       sync.Mutex
+	coverage map[string]pawn.SearchCoverage
+}
+
+// Coverage returns the coverage of the last search of each query
+func (l *coverageLog) Coverage() []pawn.SearchCoverage {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	result := []pawn.SearchCoverage{}
+	for _, c := range l.coverage {
+		result = append(result, c)
+	}
+	return result
+}
+
+func (l *coverageLog) setCoverage(c pawn.SearchCoverage) {
+	zap.L().Info("search coverage",
+		zap.String("site", c.Site),
+		zap.String("query", c.Query),
+		zap.Int("total", c.Total),
+		zap.Int("found", c.Found),
+		zap.Int("slices", c.Slices),
+		zap.Int("truncated", c.Truncated),
+		zap.Int("missed", c.Missed),
+		zap.Int("failed", c.Failed))
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.coverage == nil {
+		l.coverage = map[string]pawn.SearchCoverage{}
+	}
+	l.coverage[c.Query] = c
+}
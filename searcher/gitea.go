@@ -0,0 +1,90 @@
+package searcher
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/Southclaws/pawndex/gitea"
+	"github.com/Southclaws/pawndex/pawn"
+)
+
+// giteaPageSize is the number of results requested per page, Gitea caps this at its configured
+// MAX_RESPONSE_ITEMS which defaults to 50.
+const giteaPageSize = 50
+
+// GiteaSearcher searches for repositories on a Gitea or Forgejo instance
+type GiteaSearcher struct {
+	Gitea *gitea.Client
+}
+
+func (g *GiteaSearcher) Search(queries ...string) ([]string, error) {
+	var repos []string
+	for _, q := range queries {
+		params, ok := giteaQuery(q)
+		if !ok {
+			zap.L().Debug("query not supported by gitea", zap.String("query", q))
+			continue
+		}
+		r, err := g.doPagedSearch(params)
+		if err != nil {
+			zap.L().Warn("paged search failed", zap.Error(err), zap.Int("results", len(r)))
+		}
+		repos = append(repos, r...)
+	}
+	return repos, nil
+}
+
+// giteaQuery translates a GitHub style search query into Gitea search parameters. Gitea can only
+// match keywords or a topic, so queries with any other qualifier are not supported. Gitea can't
+// filter by activity either, so the pushed qualifier of incremental searches is dropped and every
+// result is returned.
+func giteaQuery(query string) (params url.Values, ok bool) {
+	var keywords []string
+	params = url.Values{}
+	for _, term := range strings.Fields(query) {
+		if i := strings.Index(term, ":"); i != -1 {
+			if term[:i] == "pushed" {
+				continue
+			}
+			if term[:i] != "topic" || params.Get("topic") != "" {
+				return nil, false
+			}
+			keywords = append(keywords, term[i+1:])
+			params.Set("topic", "true")
+			continue
+		}
+		keywords = append(keywords, term)
+	}
+	if len(keywords) == 0 {
+		return nil, false
+	}
+	params.Set("q", strings.Join(keywords, " "))
+	return params, true
+}
+
+func (g *GiteaSearcher) doPagedSearch(params url.Values) (repos []string, err error) {
+	params.Set("limit", strconv.Itoa(giteaPageSize))
+	for page := 1; ; page++ {
+		params.Set("page", strconv.Itoa(page))
+
+		var result gitea.SearchResults
+		if _, err = g.Gitea.Get(context.Background(), "/repos/search", params, &result); err != nil {
+			err = errors.Wrap(err, "failed to search repositories")
+			break
+		}
+		zap.L().Debug("found repositories", zap.Int("count", len(result.Data)), zap.Int("page", page))
+
+		for _, r := range result.Data {
+			repos = append(repos, pawn.Name(g.Gitea.Site(), r.Owner.Login, r.Name))
+		}
+		if len(result.Data) < giteaPageSize {
+			break
+		}
+	}
+	return
+}
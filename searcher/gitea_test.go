@@ -0,0 +1,90 @@
+package searcher_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/Southclaws/pawndex/gitea"
+	"github.com/Southclaws/pawndex/searcher"
+)
+
+func TestGiteaSearcher_Search(t *testing.T) {
+	// 60 repositories with the pawn-package topic, enough to need a second page
+	var tagged []string
+	for i := 0; i < 60; i++ {
+		tagged = append(tagged, fmt.Sprintf("repo%02d", i))
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/repos/search" {
+			http.NotFound(w, r)
+			return
+		}
+		q := r.URL.Query()
+
+		var names []string
+		switch {
+		case q.Get("topic") == "true" && q.Get("q") == "pawn-package":
+			names = tagged
+		case q.Get("topic") == "" && q.Get("q") == "samp":
+			names = []string{"samp-stdlib"}
+		}
+
+		page, _ := strconv.Atoi(q.Get("page"))
+		limit, _ := strconv.Atoi(q.Get("limit"))
+		start, end := (page-1)*limit, page*limit
+		if start > len(names) {
+			start = len(names)
+		}
+		if end > len(names) {
+			end = len(names)
+		}
+
+		var data []map[string]interface{}
+		for _, name := range names[start:end] {
+			data = append(data, map[string]interface{}{
+				"name":  name,
+				"owner": map[string]string{"login": "test"},
+			})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "data": data})
+	}))
+	defer server.Close()
+
+	site := strings.TrimPrefix(server.URL, "http://")
+	s := searcher.GiteaSearcher{Gitea: &gitea.Client{BaseURL: server.URL}}
+
+	var wantTagged []string
+	for _, name := range tagged {
+		wantTagged = append(wantTagged, site+"/test/"+name)
+	}
+
+	tests := []struct {
+		name    string
+		queries []string
+		want    []string
+	}{
+		{"topic", []string{"topic:pawn-package"}, wantTagged},
+		{"keyword", []string{"samp"}, []string{site + "/test/samp-stdlib"}},
+		{"incremental", []string{"samp pushed:>2020-01-01T00:00:00Z"}, []string{site + "/test/samp-stdlib"}},
+		{"unsupported", []string{"language:pawn"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.Search(tt.queries...)
+			if err != nil {
+				t.Errorf("GiteaSearcher.Search() error = %v", err)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GiteaSearcher.Search() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package searcher
+
+import "github.com/Southclaws/pawndex/pawn"
+
+// Hosts runs each search against multiple Searchers, typically one per host, and merges the
+// results.
+type Hosts []Searcher
+
+func (h Hosts) Search(queries ...string) ([]string, error) {
+	var repos []string
+	seen := map[string]bool{}
+	for _, s := range h {
+		r, err := s.Search(queries...)
+		if err != nil {
+			return repos, err
+		}
+		for _, name := range r {
+			if !seen[name] {
+				seen[name] = true
+				repos = append(repos, name)
+			}
+		}
+	}
+	return repos, nil
+}
+
+// Coverage returns the search coverage of every host that reports it
+func (h Hosts) Coverage() []pawn.SearchCoverage {
+	result := []pawn.SearchCoverage{}
+	for _, s := range h {
+		if r, ok := s.(CoverageReporter); ok {
+			result = append(result, r.Coverage()...)
+		}
+	}
+	return result
+}
@@ -0,0 +1,48 @@
+package searcher
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/pkg/errors"
+
+	"github.com/Southclaws/pawndex/pawn"
+)
+
+// LocalSearcher lists the git repositories in a directory on disk laid out as Root/user/repo, see
+// scraper.LocalScraper. Every repository is a candidate so queries are ignored, the scraper decides
+// which ones are packages.
+type LocalSearcher struct {
+	Root string // directory containing a directory of repositories for each user
+	Site string // host name the packages are named with, such as "local"
+}
+
+func (l *LocalSearcher) Search(queries ...string) ([]string, error) {
+	users, err := ioutil.ReadDir(l.Root)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read repository root")
+	}
+
+	var repos []string
+	for _, user := range users {
+		if !user.IsDir() {
+			continue
+		}
+		dirs, err := ioutil.ReadDir(filepath.Join(l.Root, user.Name()))
+		if err != nil {
+			return repos, errors.Wrap(err, "failed to read user directory")
+		}
+		for _, dir := range dirs {
+			if !dir.IsDir() {
+				continue
+			}
+			if _, err := git.PlainOpen(filepath.Join(l.Root, user.Name(), dir.Name())); err != nil {
+				continue
+			}
+			repos = append(repos, pawn.Name(l.Site, user.Name(), strings.TrimSuffix(dir.Name(), ".git")))
+		}
+	}
+	return repos, nil
+}
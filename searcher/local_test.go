@@ -0,0 +1,50 @@
+package searcher_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+
+	"github.com/Southclaws/pawndex/searcher"
+)
+
+func TestLocalSearcher_Search(t *testing.T) {
+	root, err := ioutil.TempDir("", "pawndex")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	for _, repo := range []struct {
+		path string
+		bare bool
+	}{
+		{"alice/working", false},
+		{"alice/mirror.git", true},
+		{"bob/other", false},
+	} {
+		if _, err := git.PlainInit(filepath.Join(root, repo.path), repo.bare); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.MkdirAll(filepath.Join(root, "bob", "not-a-repo"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, "README.md"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := searcher.LocalSearcher{Root: root, Site: "local"}
+	got, err := s.Search("topic:pawn-package")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"local/alice/mirror", "local/alice/working", "local/bob/other"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("LocalSearcher.Search() = %v, want %v", got, want)
+	}
+}
@@ -3,10 +3,32 @@ package searcher
 import (
 	"context"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/google/go-github/github"
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
+
+	"github.com/Southclaws/pawndex/pawn"
+)
+
+const (
+	// maxSearchResults is the number of results GitHub returns for a single query, queries that
+	// match more are split into slices by creation date.
+	maxSearchResults = 1000
+	// searchPageSize is the largest page size GitHub allows for searches
+	searchPageSize = 100
+	// minCreatedSlice is the narrowest creation date range a query is split into before it's
+	// split by stars instead.
+	minCreatedSlice = time.Hour
+)
+
+var (
+	// searchEpoch is before any repository on GitHub was created
+	searchEpoch = time.Date(2007, 10, 1, 0, 0, 0, 0, time.UTC)
+	// starSlices split a query that is still over the limit after splitting by creation date
+	starSlices = []string{"0", "1", "2..4", "5..9", "10..49", ">=50"}
 )
 
 type Searcher interface {
@@ -15,52 +37,177 @@ type Searcher interface {
 
 type GitHubSearcher struct {
 	GitHub *github.Client
+	Site   string // host packages are named with, defaults to github.com
+
+	coverageLog
 }
 
 func (g *GitHubSearcher) Search(queries ...string) ([]string, error) {
 	var repos []string
+	seen := map[string]bool{}
 	for _, q := range queries {
-		r, err := g.doPagedSearch(q)
-		if err != nil {
-			zap.L().Warn("paged search failed", zap.Error(err), zap.Int("results", len(r)))
+		r, coverage := g.searchQuery(q)
+		g.setCoverage(coverage)
+
+		for _, name := range r {
+			if !seen[name] {
+				seen[name] = true
+				repos = append(repos, name)
+			}
 		}
-		repos = append(repos, r...)
 	}
 	return repos, nil
 }
 
-func (g *GitHubSearcher) doPagedSearch(query string) (repos []string, err error) {
-	page := 0
-	for {
-		var result []github.Repository
-		result, err = g.runQueryForPage(query, page)
+// slicedSearch collects the results of a query that may be split into slices
+type slicedSearch struct {
+	g        *GitHubSearcher
+	seen     map[string]bool
+	repos    []string
+	coverage pawn.SearchCoverage
+}
+
+// searchQuery retrieves every result of a query, splitting it into slices if it has more results
+// than GitHub returns for a single query. Failed requests are counted in the coverage.
+func (g *GitHubSearcher) searchQuery(query string) (repos []string, coverage pawn.SearchCoverage) {
+	s := &slicedSearch{
+		g:    g,
+		seen: map[string]bool{},
+		coverage: pawn.SearchCoverage{
+			Site: g.site(),
+			Time: time.Now().UTC(),
+		},
+	}
+	// incremental searches are recorded against the query they narrow so each query only has one
+	// coverage record
+	s.coverage.Query, s.coverage.Pushed = splitPushed(query)
+
+	first, total, err := g.runQueryForPage(query, 1)
+	if err != nil {
+		// nothing was searched, the whole query failed as a single slice
+		s.fail(query, err)
+		return nil, s.coverage
+	}
+	s.coverage.Total = total
+
+	if total <= maxSearchResults {
+		s.collect(query, first, total)
+	} else {
+		s.byCreated(query, searchEpoch, s.coverage.Time.Truncate(time.Second))
+	}
+
+	s.coverage.Found = len(s.repos)
+	return s.repos, s.coverage
+}
+
+// splitPushed separates the pushed qualifier from a query
+func splitPushed(query string) (base, pushed string) {
+	var terms []string
+	for _, term := range strings.Fields(query) {
+		if strings.HasPrefix(term, "pushed:") {
+			pushed = strings.TrimPrefix(term, "pushed:")
+			continue
+		}
+		terms = append(terms, term)
+	}
+	return strings.Join(terms, " "), pushed
+}
+
+// byCreated searches for the repositories created in a date range, splitting the range in half
+// until each slice is under the limit
+func (s *slicedSearch) byCreated(query string, from, to time.Time) {
+	q := fmt.Sprintf("%s created:%s..%s", query, from.Format(time.RFC3339), to.Format(time.RFC3339))
+	first, total, err := s.g.runQueryForPage(q, 1)
+	if err != nil {
+		s.fail(q, err)
+		return
+	}
+	if total <= maxSearchResults {
+		s.collect(q, first, total)
+		return
+	}
+	if to.Sub(from) <= minCreatedSlice {
+		s.byStars(q)
+		return
+	}
+
+	mid := from.Add(to.Sub(from) / 2).Truncate(time.Second)
+	s.byCreated(query, from, mid)
+	s.byCreated(query, mid.Add(time.Second), to)
+}
+
+// byStars splits a query by star count, slices still over the limit are truncated
+func (s *slicedSearch) byStars(query string) {
+	for _, stars := range starSlices {
+		q := fmt.Sprintf("%s stars:%s", query, stars)
+		first, total, err := s.g.runQueryForPage(q, 1)
+		if err != nil {
+			s.fail(q, err)
+			continue
+		}
+		s.collect(q, first, total)
+	}
+}
+
+// collect adds the first page of results of a slice and pages through the rest of them
+func (s *slicedSearch) collect(query string, first []github.Repository, total int) {
+	s.coverage.Slices++
+	if total > maxSearchResults {
+		zap.L().Warn("search slice over result limit, results truncated",
+			zap.String("query", query), zap.Int("total", total))
+		s.coverage.Truncated++
+		s.coverage.Missed += total - maxSearchResults
+		total = maxSearchResults
+	}
+
+	s.add(first)
+	for page := 2; (page-1)*searchPageSize < total; page++ {
+		result, _, err := s.g.runQueryForPage(query, page)
 		if err != nil {
-			break
+			s.fail(query, err)
+			return
 		}
 		zap.L().Debug("found repositories", zap.Int("count", len(result)), zap.Int("page", page))
 		if len(result) == 0 {
-			break
+			return
 		}
+		s.add(result)
+	}
+}
 
-		for _, r := range result {
-			repos = append(repos, fmt.Sprintf("%s/%s", r.Owner.GetLogin(), r.GetName()))
+func (s *slicedSearch) add(result []github.Repository) {
+	for _, r := range result {
+		name := pawn.Name(s.g.site(), r.Owner.GetLogin(), r.GetName())
+		if !s.seen[name] {
+			s.seen[name] = true
+			s.repos = append(s.repos, name)
 		}
-		page += 1
 	}
-	return
 }
 
-func (g *GitHubSearcher) runQueryForPage(query string, page int) (repos []github.Repository, err error) {
+func (s *slicedSearch) fail(query string, err error) {
+	zap.L().Warn("search slice failed", zap.String("query", query), zap.Error(err))
+	s.coverage.Failed++
+}
+
+func (g *GitHubSearcher) site() string {
+	if g.Site == "" {
+		return pawn.DefaultSite
+	}
+	return g.Site
+}
+
+func (g *GitHubSearcher) runQueryForPage(query string, page int) (repos []github.Repository, total int, err error) {
 	results, _, err := g.GitHub.Search.Repositories(
 		context.Background(),
 		query,
 		&github.SearchOptions{ListOptions: github.ListOptions{
 			Page:    page,
-			PerPage: 100,
+			PerPage: searchPageSize,
 		}})
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to search repositories")
+		return nil, 0, errors.Wrap(err, "failed to search repositories")
 	}
 
-	return results.Repositories, nil
+	return results.Repositories, results.GetTotal(), nil
 }
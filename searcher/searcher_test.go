@@ -1,36 +1,126 @@
 package searcher_test
 
 import (
-	"context"
 	"fmt"
-	"os"
+	"reflect"
 	"testing"
+	"time"
 
-	"github.com/google/go-github/github"
-	"github.com/joho/godotenv" // loads environment variables from .env
-	"golang.org/x/oauth2"
-
+	"github.com/Southclaws/pawndex/githubtest"
 	"github.com/Southclaws/pawndex/searcher"
 )
 
 func TestGitHubSearcher_Search(t *testing.T) {
-	godotenv.Load("../.env")
-	token := os.Getenv("PAWNDEX_GITHUBTOKEN")
-	if token == "" {
-		panic("tests need a token to run.")
+	pushed := time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)
+	repos := []githubtest.Repository{
+		{Owner: "Southclaws", Name: "samp-logger", Topics: []string{"pawn-package"}, Language: "Pawn", Pushed: pushed},
+		{Owner: "Southclaws", Name: "samp-old", Topics: []string{"pawn-package"}, Language: "C", Pushed: pushed.AddDate(-1, 0, 0)},
+		{Owner: "test", Name: "sa-mp-thing", Topics: []string{"sa-mp"}, Language: "C"},
+		{Owner: "test", Name: "plugin", Language: "C++"},
+	}
+	// enough Pawn repositories for several pages of results
+	var many []string
+	for i := 0; i < 250; i++ {
+		name := fmt.Sprintf("lib%03d", i)
+		repos = append(repos, githubtest.Repository{Owner: "many", Name: name, Language: "Pawn"})
+		many = append(many, "github.com/many/"+name)
 	}
 
-	s := searcher.GitHubSearcher{
-		GitHub: github.NewClient(
-			oauth2.NewClient(
-				context.Background(),
-				oauth2.StaticTokenSource(&oauth2.Token{
-					AccessToken: token,
-				}),
-			)),
+	server := githubtest.NewServer(repos...)
+	defer server.Close()
+
+	s := searcher.GitHubSearcher{GitHub: server.GitHub()}
+
+	tests := []struct {
+		name    string
+		queries []string
+		want    []string
+	}{
+		{"topic", []string{"topic:pawn-package"}, []string{
+			"github.com/Southclaws/samp-logger",
+			"github.com/Southclaws/samp-old",
+		}},
+		{"multiple", []string{"topic:pawn-package", "topic:sa-mp"}, []string{
+			"github.com/Southclaws/samp-logger",
+			"github.com/Southclaws/samp-old",
+			"github.com/test/sa-mp-thing",
+		}},
+		{"pushed", []string{"topic:pawn-package pushed:>2020-01-01T00:00:00Z"}, []string{
+			"github.com/Southclaws/samp-logger",
+		}},
+		{"paged", []string{"language:pawn"}, append(many, "github.com/Southclaws/samp-logger")},
+		{"none", []string{"topic:nothing"}, nil},
 	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.Search(tt.queries...)
+			if err != nil {
+				t.Errorf("GitHubSearcher.Search() error = %v", err)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GitHubSearcher.Search() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
 
-	results, err := s.Search("topic:pawn-package")
-	fmt.Println(err)
-	fmt.Println(results)
+func TestGitHubSearcher_SearchSliced(t *testing.T) {
+	var repos []githubtest.Repository
+	// more Pawn repositories than a single query returns, created a day apart
+	start := time.Date(2012, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 2500; i++ {
+		repos = append(repos, githubtest.Repository{
+			Owner: "spread", Name: fmt.Sprintf("lib%04d", i), Language: "Pawn",
+			Created: start.AddDate(0, 0, i), Stars: i % 7,
+		})
+	}
+	// repositories created at the same time can only be split by stars, the unstarred ones can't
+	// be split any further
+	for i := 0; i < 1300; i++ {
+		stars := 0
+		if i >= 1100 {
+			stars = 10
+		}
+		repos = append(repos, githubtest.Repository{
+			Owner: "burst", Name: fmt.Sprintf("lib%04d", i), Topics: []string{"burst"},
+			Created: start, Stars: stars,
+		})
+	}
+
+	server := githubtest.NewServer(repos...)
+	defer server.Close()
+
+	tests := []struct {
+		name          string
+		query         string
+		wantFound     int
+		wantTruncated int
+		wantMissed    int
+	}{
+		{"split by created", "language:pawn", 2500, 0, 0},
+		{"split by stars", "topic:burst", 1200, 1, 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := searcher.GitHubSearcher{GitHub: server.GitHub()}
+			got, err := s.Search(tt.query)
+			if err != nil {
+				t.Fatalf("GitHubSearcher.Search() error = %v", err)
+			}
+			if len(got) != tt.wantFound {
+				t.Errorf("GitHubSearcher.Search() found %d, want %d", len(got), tt.wantFound)
+			}
+
+			coverage := s.Coverage()
+			if len(coverage) != 1 {
+				t.Fatalf("GitHubSearcher.Coverage() = %v, want one query", coverage)
+			}
+			c := coverage[0]
+			if c.Query != tt.query || c.Total != len(got)+tt.wantMissed || c.Found != tt.wantFound ||
+				c.Truncated != tt.wantTruncated || c.Missed != tt.wantMissed || c.Failed != 0 || c.Slices < 2 {
+				t.Errorf("GitHubSearcher.Coverage() = %+v", c)
+			}
+		})
+	}
 }
@@ -2,13 +2,19 @@ package service
 
 import (
 	"context"
+	"strings"
 	"time"
 
 	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
 	"golang.org/x/oauth2"
 
 	"github.com/Southclaws/pawndex/api"
 	"github.com/Southclaws/pawndex/daemon"
+	"github.com/Southclaws/pawndex/gitea"
+	"github.com/Southclaws/pawndex/httpcache"
+	"github.com/Southclaws/pawndex/pawn"
+	"github.com/Southclaws/pawndex/ratelimit"
 	"github.com/Southclaws/pawndex/scraper"
 	"github.com/Southclaws/pawndex/searcher"
 	"github.com/Southclaws/pawndex/storage"
@@ -24,37 +30,135 @@ type App struct {
 
 // Config stores static configuration
 type Config struct {
-	Bind           string        `required:"true"` // bind interface
-	GithubToken    string        `required:"true"` // GitHub API token
-	SearchInterval time.Duration `required:"true"` // interval between checks
-	ScrapeInterval time.Duration `required:"true"` // interval between scrapes
-	DatabasePath   string        `required:"true"` // cache for persistence
+	Bind               string        `required:"true"` // bind interface
+	GithubToken        string        `required:"true"` // GitHub API token
+	GithubAPIURL       string        // REST API base URL, for GitHub Enterprise Server or a stand-in
+	GithubUploadURL    string        // upload API base URL, defaults to the API URL
+	GithubRawURL       string        // raw content base URL, without one files are read via the API
+	GithubHookSecret   string        // secret of GitHub webhooks, enables the webhook receiver
+	AdminToken         string        // bearer token of the /admin routes, enables them
+	GithubRateReserve  float64       `default:"0.1"`   // fraction of the GitHub rate limit left unspent
+	SearchInterval     time.Duration `required:"true"` // interval between checks
+	FullSearchInterval time.Duration `default:"24h"`   // interval between searches for all repositories, not just recently pushed
+	ScrapeInterval     time.Duration `required:"true"` // interval between scrapes
+	ScrapeWorkers      int           `default:"4"`     // repositories scraped at once
+	ScrapeRetry        time.Duration `default:"5m"`    // time before retrying a failed scrape, doubled after each failure
+	ScrapeRetryMax     time.Duration `default:"24h"`   // longest time between retries
+	ScrapeMaxAttempts  int           `default:"10"`    // failures in a row before giving up on a repository
+	DatabasePath       string        `required:"true"` // cache for persistence
+	QueriesFile        string        // optional YAML file of discovery queries
+	CrawlInterval      time.Duration `default:"1h"`   // interval between crawls of package dependencies, zero disables
+	CrawlDepth         int           `default:"3"`    // dependency distance from searched packages to crawl
+	CrawlLimit         int           `default:"100"`  // repositories marked per crawl
+	RefreshInterval    time.Duration `default:"1h"`   // interval between checks for stale packages, zero disables
+	RefreshMin         time.Duration `default:"6h"`   // shortest time between scrapes of a package
+	RefreshMax         time.Duration `default:"720h"` // longest time between scrapes of a package
+	RefreshLimit       int           `default:"100"`  // stale packages marked per check
+	GiteaURL           string        // optional Gitea instance to index alongside GitHub
+	GiteaToken         string        // Gitea API token, for private repositories
+	LocalRoot          string        // optional directory of git repositories laid out as user/repo
+	LocalSite          string        `default:"local"` // host name of packages in LocalRoot
+	SubmitLimit        int           `default:"10"`    // submissions each client can make per SubmitLimitPeriod, zero is no limit
+	SubmitLimitPeriod  time.Duration `default:"1h"`
 }
 
 // Initialise prepres the service for starting
 func Initialise(ctx context.Context, config Config) (app *App, err error) {
-	gh := github.NewClient(oauth2.NewClient(ctx, oauth2.StaticTokenSource(&oauth2.Token{AccessToken: config.GithubToken})))
-	search := searcher.GitHubSearcher{GitHub: gh}
-	scrape := scraper.GitHubScraper{GitHub: gh}
 	store, err := storage.New(config.DatabasePath)
 	if err != nil {
 		return nil, err
 	}
+	gh, site, err := githubClient(ctx, config, store)
+	if err != nil {
+		return nil, err
+	}
+	rawURL := config.GithubRawURL
+	if rawURL == "" && config.GithubAPIURL == "" {
+		rawURL = scraper.DefaultRawURL
+	} else if rawURL != "" && !strings.HasSuffix(rawURL, "/") {
+		rawURL += "/" // file paths are appended to it
+	}
+	search := searcher.GitHubSearcher{GitHub: gh, Site: site}
+	scrape := scraper.GitHubScraper{GitHub: gh, RawURL: rawURL, Site: site, Index: store}
+
+	queries := daemon.DefaultQueries
+	if config.QueriesFile != "" {
+		queries, err = daemon.LoadQueries(config.QueriesFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	searchers := searcher.Hosts{&search}
+	scrapers := scraper.Hosts{site: &scrape}
+	if config.GiteaURL != "" {
+		gt := &gitea.Client{BaseURL: config.GiteaURL, Token: config.GiteaToken}
+		searchers = append(searchers, &searcher.GiteaSearcher{Gitea: gt})
+		scrapers[gt.Site()] = &scraper.GiteaScraper{Gitea: gt, Index: store}
+	}
+	if config.LocalRoot != "" {
+		searchers = append(searchers, &searcher.LocalSearcher{Root: config.LocalRoot, Site: config.LocalSite})
+		scrapers[config.LocalSite] = &scraper.LocalScraper{Root: config.LocalRoot, Site: config.LocalSite, Index: store}
+	}
+
+	refresh := make(chan string, 100)
+	hook := api.GitHubWebhook{Secret: config.GithubHookSecret, Site: site, Refresh: refresh}
 
 	return &App{
 		config: config,
 		gh:     gh,
-		server: api.New(config.Bind, store),
+		server: api.New(config.Bind, store, scrapers, hook, api.SubmitLimit{
+			Requests: config.SubmitLimit,
+			Period:   config.SubmitLimitPeriod,
+		}, config.AdminToken),
 		daemon: daemon.Daemon{
-			Searcher:       &search,
-			Scraper:        &scrape,
-			Storer:         store,
-			SearchInterval: config.SearchInterval,
-			ScrapeInterval: config.ScrapeInterval,
+			Searcher:           searchers,
+			CodeSearcher:       &searcher.GitHubCodeSearcher{GitHub: gh, Site: site},
+			Scraper:            scrapers,
+			Storer:             store,
+			SearchInterval:     config.SearchInterval,
+			ScrapeInterval:     config.ScrapeInterval,
+			FullSearchInterval: config.FullSearchInterval,
+			Queries:            queries,
+			CrawlInterval:      config.CrawlInterval,
+			CrawlDepth:         config.CrawlDepth,
+			CrawlLimit:         config.CrawlLimit,
+			Refresh:            refresh,
+			Workers:            config.ScrapeWorkers,
+			RetryBackoff:       config.ScrapeRetry,
+			MaxRetryBackoff:    config.ScrapeRetryMax,
+			MaxAttempts:        config.ScrapeMaxAttempts,
+			RefreshInterval:    config.RefreshInterval,
+			RefreshMin:         config.RefreshMin,
+			RefreshMax:         config.RefreshMax,
+			RefreshLimit:       config.RefreshLimit,
 		},
 	}, nil
 }
 
+// githubClient creates a client for github.com, or the instance at the configured API URL in which
+// case packages are named with its host instead. Requests wait for the rate limit to reset once
+// it's down to the configured reserve, and responses are cached in the database so requests for
+// things that haven't changed don't count towards the rate limit.
+func githubClient(ctx context.Context, config Config, store *storage.DB) (gh *github.Client, site string, err error) {
+	httpClient := oauth2.NewClient(ctx, oauth2.StaticTokenSource(&oauth2.Token{AccessToken: config.GithubToken}))
+	budget := &ratelimit.Budget{Reserve: config.GithubRateReserve}
+	httpClient.Transport = &httpcache.Transport{Store: store, Base: budget.Transport(httpClient.Transport)}
+	if config.GithubAPIURL == "" {
+		return github.NewClient(httpClient), pawn.DefaultSite, nil
+	}
+
+	uploadURL := config.GithubUploadURL
+	if uploadURL == "" {
+		uploadURL = config.GithubAPIURL
+	}
+	gh, err = github.NewEnterpriseClient(config.GithubAPIURL, uploadURL, httpClient)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "invalid GitHub API URL")
+	}
+	return gh, gh.BaseURL.Host, nil
+}
+
 // Start initialises the app and blocks until fatal error
 func (app *App) Start(ctx context.Context) (err error) {
 	errs := make(chan error)
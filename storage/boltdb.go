@@ -2,6 +2,8 @@ package storage
 
 import (
 	"encoding/json"
+	"strings"
+	"time"
 
 	bolt "go.etcd.io/bbolt"
 
@@ -17,6 +19,18 @@ type DB struct {
 type Entry struct {
 	Pkg    pawn.Package
 	Marked bool
+	// Depth is the dependency distance from a package found by searching, zero for packages
+	// found by searching themselves
+	Depth int `json:",omitempty"`
+	// Discovery lists each way the repository was found
+	Discovery []Discovery `json:",omitempty"`
+	// Submissions lists the IDs of submissions waiting for the repository to be scraped
+	Submissions []string `json:",omitempty"`
+	// Failure records the failed scrapes of the repository since it was last scraped
+	Failure *Failure `json:",omitempty"`
+	// Scraped is when the package was last stored, zero for repositories that haven't been
+	// scraped and packages stored before this was recorded
+	Scraped time.Time `json:",omitempty"`
 }
 
 func New(path string) (*DB, error) {
@@ -30,6 +44,22 @@ func New(path string) (*DB, error) {
 		if err != nil {
 			return err
 		}
+		symbolsMigrated, err := migrateSymbols(t)
+		if err != nil {
+			return err
+		}
+		migrated, err := migrateSites(t)
+		if err != nil {
+			return err
+		}
+		if symbolsMigrated && !migrated {
+			if err := rebuildSymbols(t); err != nil {
+				return err
+			}
+		}
+		if migrated || needsReindex(t) {
+			return reindex(t)
+		}
 		return nil
 	}); err != nil {
 		return nil, err
@@ -72,6 +102,8 @@ func (db *DB) GetAll() ([]pawn.Package, error) {
 }
 
 func (db *DB) Get(name string) (pkg pawn.Package, exists bool, err error) {
+	name = pawn.CanonicalName(name)
+
 	if err := db.db.View(func(t *bolt.Tx) error {
 		bkt := t.Bucket(packagesBucket)
 		raw := bkt.Get([]byte(name))
@@ -98,6 +130,40 @@ func (db *DB) Get(name string) (pkg pawn.Package, exists bool, err error) {
 	return
 }
 
+// Lookup returns a package like Get, but when no package is named exactly as given it matches the
+// name regardless of case, for names spelled differently to the host such as in dependencies.
+func (db *DB) Lookup(name string) (pkg pawn.Package, exists bool, err error) {
+	if pkg, exists, err = db.Get(name); err != nil || exists {
+		return
+	}
+	meta, err := pawn.ParseName(name)
+	if err != nil {
+		return pkg, false, nil
+	}
+	name = pawn.Name(meta.Site, meta.User, meta.Repo)
+
+	err = db.db.View(func(t *bolt.Tx) error {
+		c := t.Bucket(packagesBucket).Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			if !strings.EqualFold(string(k), name) {
+				continue
+			}
+			var e Entry
+			if err := json.Unmarshal(v, &e); err != nil {
+				return err
+			}
+			if e.Pkg.User == "" {
+				continue
+			}
+			pkg = e.Pkg
+			exists = true
+			return nil
+		}
+		return nil
+	})
+	return
+}
+
 func (db *DB) Set(p pawn.Package) error {
 	return db.db.Update(func(t *bolt.Tx) error {
 		bkt, err := t.CreateBucketIfNotExists(packagesBucket)
@@ -105,7 +171,33 @@ func (db *DB) Set(p pawn.Package) error {
 			return err
 		}
 
-		raw, err := json.Marshal(Entry{p, false})
+		var old Entry
+		if raw := bkt.Get([]byte(p.String())); raw != nil {
+			if err := json.Unmarshal(raw, &old); err != nil {
+				return err
+			}
+		}
+
+		if err := updateIndexes(t, old.Pkg, p); err != nil {
+			return err
+		}
+		if err := putVersions(t, p); err != nil {
+			return err
+		}
+		if err := putSymbols(t, p); err != nil {
+			return err
+		}
+
+		if err := resolveSubmissions(t, old.Submissions, SubmissionScraped, ""); err != nil {
+			return err
+		}
+
+		raw, err := json.Marshal(Entry{
+			Pkg:       p,
+			Depth:     old.Depth,
+			Discovery: old.Discovery,
+			Scraped:   time.Now().UTC(),
+		})
 		if err != nil {
 			return err
 		}
@@ -119,6 +211,17 @@ func (db *DB) Set(p pawn.Package) error {
 }
 
 func (db *DB) MarkForScrape(name string) error {
+	return db.markForScrape(name, nil)
+}
+
+// MarkFound marks a repository found by searching for scraping and records how it was found
+func (db *DB) MarkFound(name string, d Discovery) error {
+	return db.markForScrape(name, &d)
+}
+
+func (db *DB) markForScrape(name string, d *Discovery) error {
+	name = pawn.CanonicalName(name)
+
 	return db.db.Update(func(t *bolt.Tx) error {
 		bkt, err := t.CreateBucketIfNotExists(packagesBucket)
 		if err != nil {
@@ -135,6 +238,10 @@ func (db *DB) MarkForScrape(name string) error {
 		}
 
 		e.Marked = true
+		e.Depth = 0
+		if d != nil {
+			e.addDiscovery(*d)
+		}
 
 		raw, err := json.Marshal(e)
 		if err != nil {
@@ -149,8 +256,81 @@ func (db *DB) MarkForScrape(name string) error {
 	})
 }
 
+// Unmark clears the mark of a repository that turned out not to be a package, so it isn't
+// scraped again until it's marked again
+func (db *DB) Unmark(name string) error {
+	name = pawn.CanonicalName(name)
+
+	return db.db.Update(func(t *bolt.Tx) error {
+		bkt := t.Bucket(packagesBucket)
+		raw := bkt.Get([]byte(name))
+		if raw == nil {
+			return nil
+		}
+
+		var e Entry
+		if err := json.Unmarshal(raw, &e); err != nil {
+			return err
+		}
+		e.Marked = false
+		e.Failure = nil
+
+		raw, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		return bkt.Put([]byte(name), raw)
+	})
+}
+
+// Delete removes a repository and everything indexed from it, for repositories that no longer
+// exist. Pending submissions of it are rejected and cached responses about it are dropped.
+func (db *DB) Delete(name string) error {
+	name = pawn.CanonicalName(name)
+
+	return db.db.Update(func(t *bolt.Tx) error {
+		bkt := t.Bucket(packagesBucket)
+		raw := bkt.Get([]byte(name))
+		if raw == nil {
+			return nil
+		}
+
+		var e Entry
+		if err := json.Unmarshal(raw, &e); err != nil {
+			return err
+		}
+		if e.Pkg.Repo != "" {
+			if err := updateIndexes(t, e.Pkg, pawn.Package{}); err != nil {
+				return err
+			}
+			// storing the package without versions or symbols removes them
+			gone := pawn.Package{}
+			gone.DependencyMeta = e.Pkg.DependencyMeta
+			if err := putVersions(t, gone); err != nil {
+				return err
+			}
+			if err := putSymbols(t, gone); err != nil {
+				return err
+			}
+		}
+		if err := resolveSubmissions(t, e.Submissions, SubmissionRejected, "repository was deleted"); err != nil {
+			return err
+		}
+		if meta, err := pawn.ParseName(name); err == nil {
+			if err := deleteResponses(t, meta.User, meta.Repo); err != nil {
+				return err
+			}
+		}
+		return bkt.Delete([]byte(name))
+	})
+}
+
+// GetMarked returns every repository marked for scraping, submitted repositories first. Those
+// waiting to be retried after failing are left out.
 func (db *DB) GetMarked() ([]string, error) {
 	packages := []string{}
+	submitted := []string{}
+	now := time.Now()
 
 	if err := db.db.View(func(t *bolt.Tx) error {
 		bkt := t.Bucket(packagesBucket)
@@ -163,7 +343,12 @@ func (db *DB) GetMarked() ([]string, error) {
 				return err
 			}
 
-			if e.Marked {
+			if e.Failure.waiting(now) {
+				continue
+			}
+			if e.Marked && len(e.Submissions) > 0 {
+				submitted = append(submitted, string(k))
+			} else if e.Marked {
 				packages = append(packages, string(k))
 			}
 		}
@@ -172,5 +357,5 @@ func (db *DB) GetMarked() ([]string, error) {
 	}); err != nil {
 		return nil, err
 	}
-	return packages, nil
+	return append(submitted, packages...), nil
 }
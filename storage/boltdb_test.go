@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"encoding/json"
 	"os"
 	"reflect"
 	"testing"
@@ -9,11 +10,14 @@ import (
 	"github.com/Southclaws/pawndex/pawn"
 	"github.com/Southclaws/sampctl/pawnpackage"
 	"github.com/Southclaws/sampctl/versioning"
+	bolt "go.etcd.io/bbolt"
 )
 
 var (
 	database *DB
 	now      = time.Now().Truncate(time.Hour)
+	// storedNow is now as it reads back from the database, where times are kept in UTC
+	storedNow = now.UTC()
 )
 
 func TestMain(m *testing.M) {
@@ -230,7 +234,7 @@ func TestDB_GetMarked(t *testing.T) {
 		wantErr bool
 	}{
 		{"marked", database, []string{
-			"Southclaws/TestPackage2",
+			"github.com/Southclaws/TestPackage2",
 		}, false},
 	}
 	for _, tt := range tests {
@@ -276,8 +280,8 @@ func TestDB_GetMarked2(t *testing.T) {
 		wantErr bool
 	}{
 		{"marked", database, []string{
-			"Southclaws/TestPackage2",
-			"Southclaws/TestPackage3",
+			"github.com/Southclaws/TestPackage2",
+			"github.com/Southclaws/TestPackage3",
 		}, false},
 	}
 	for _, tt := range tests {
@@ -345,3 +349,1137 @@ func TestDB_GetUnscraped(t *testing.T) {
 		})
 	}
 }
+
+func TestDB_Search(t *testing.T) {
+	for _, p := range []pawn.Package{
+		{
+			Package: pawnpackage.Package{
+				DependencyMeta: versioning.DependencyMeta{
+					User: "Southclaws",
+					Repo: "samp-logger",
+				},
+			},
+			Classification: pawn.ClassificationPawnPackage,
+			Description:    "Structured logging for Pawn",
+			Stars:          20,
+			Updated:        now,
+		},
+		{
+			Package: pawnpackage.Package{
+				DependencyMeta: versioning.DependencyMeta{
+					User: "someone",
+					Repo: "logger",
+				},
+			},
+			Classification: pawn.ClassificationBuried,
+			Description:    "Another logger",
+			Updated:        now,
+		},
+	} {
+		if err := database.Set(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		db      *DB
+		query   string
+		want    []string
+		wantErr bool
+	}{
+		{"exact", database, "logger", []string{"github.com/Southclaws/samp-logger", "github.com/someone/logger"}, false},
+		{"prefix", database, "log", []string{"github.com/Southclaws/samp-logger", "github.com/someone/logger"}, false},
+		{"all terms", database, "structured log", []string{"github.com/Southclaws/samp-logger"}, false},
+		{"user", database, "someone", []string{"github.com/someone/logger"}, false},
+		{"none", database, "nothing", []string{}, false},
+		{"empty", database, "", []string{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.db.Search(tt.query)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("DB.Search() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			names := []string{}
+			for _, p := range got {
+				names = append(names, p.String())
+			}
+			if !reflect.DeepEqual(names, tt.want) {
+				t.Errorf("DB.Search() = %v, want %v", names, tt.want)
+			}
+		})
+	}
+}
+
+func TestDB_Query(t *testing.T) {
+	tests := []struct {
+		name     string
+		db       *DB
+		query    Query
+		want     []string
+		wantNext bool
+		wantErr  bool
+	}{
+		{"all", database, Query{}, []string{
+			"github.com/Southclaws/TestPackage1",
+			"github.com/Southclaws/TestPackage2",
+			"github.com/Southclaws/TestPackage3",
+			"github.com/Southclaws/samp-logger",
+			"github.com/someone/logger",
+		}, false, false},
+		{"user", database, Query{User: "someone"}, []string{"github.com/someone/logger"}, false, false},
+		{"classification", database, Query{Classification: pawn.ClassificationBuried}, []string{"github.com/someone/logger"}, false, false},
+		{"min stars", database, Query{MinStars: 1, Sort: SortStars}, []string{
+			"github.com/Southclaws/TestPackage1",
+			"github.com/Southclaws/TestPackage2",
+			"github.com/Southclaws/TestPackage3",
+			"github.com/Southclaws/samp-logger",
+		}, false, false},
+		{"sort stars", database, Query{Sort: SortStars, Limit: 4}, []string{
+			"github.com/Southclaws/TestPackage1",
+			"github.com/Southclaws/TestPackage2",
+			"github.com/Southclaws/TestPackage3",
+			"github.com/Southclaws/samp-logger",
+		}, true, false},
+		{"updated since", database, Query{UpdatedSince: now.Add(time.Hour)}, []string{}, false, false},
+		{"bad sort", database, Query{Sort: "bad"}, nil, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, next, err := tt.db.Query(tt.query)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("DB.Query() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			names := []string{}
+			for _, p := range got {
+				names = append(names, p.String())
+			}
+			if !reflect.DeepEqual(names, tt.want) {
+				t.Errorf("DB.Query() = %v, want %v", names, tt.want)
+			}
+			if (next != "") != tt.wantNext {
+				t.Errorf("DB.Query() next = %v, wantNext %v", next, tt.wantNext)
+			}
+		})
+	}
+}
+
+func TestDB_QueryPaginated(t *testing.T) {
+	var (
+		names  []string
+		cursor string
+	)
+	for {
+		got, next, err := database.Query(Query{Sort: SortStars, Limit: 2, Cursor: cursor})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, p := range got {
+			names = append(names, p.String())
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+
+	want := []string{
+		"github.com/Southclaws/TestPackage1",
+		"github.com/Southclaws/TestPackage2",
+		"github.com/Southclaws/TestPackage3",
+		"github.com/Southclaws/samp-logger",
+		"github.com/someone/logger",
+	}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("DB.Query() pages = %v, want %v", names, want)
+	}
+
+	// a full page with nothing matching after it is the last page
+	for _, q := range []Query{
+		{Sort: SortStars, Limit: len(want)},
+		{User: "someone", Limit: 1},
+	} {
+		if got, next, err := database.Query(q); err != nil || len(got) != q.Limit || next != "" {
+			t.Errorf("DB.Query(%+v) = %d packages, next %q, %v, want a full page without a cursor", q, len(got), next, err)
+		}
+	}
+}
+
+func TestDB_Versions(t *testing.T) {
+	v1 := pawnpackage.Package{
+		DependencyMeta: versioning.DependencyMeta{
+			User:   "Southclaws",
+			Repo:   "TestVersions",
+			Tag:    "1.0.0",
+			Commit: "a",
+		},
+		Entry: "test.pwn",
+	}
+	v2 := pawnpackage.Package{
+		DependencyMeta: versioning.DependencyMeta{
+			User:   "Southclaws",
+			Repo:   "TestVersions",
+			Tag:    "1.1.0",
+			Commit: "b",
+		},
+		Entry:        "test.pwn",
+		Dependencies: []versioning.DependencyString{"pawn-lang/samp-stdlib"},
+	}
+	if err := database.Set(pawn.Package{
+		Package: pawnpackage.Package{
+			DependencyMeta: versioning.DependencyMeta{
+				User: "Southclaws",
+				Repo: "TestVersions",
+			},
+		},
+		Classification: pawn.ClassificationPawnPackage,
+		Tags:           []string{"1.1.0", "1.0.0"},
+		Versions:       []pawnpackage.Package{v1, v2},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		db         *DB
+		pkg        string
+		tag        string
+		wantPkg    pawnpackage.Package
+		wantExists bool
+		wantErr    bool
+	}{
+		{"1.0.0", database, "github.com/Southclaws/TestVersions", "1.0.0", v1, true, false},
+		{"1.1.0", database, "github.com/Southclaws/TestVersions", "1.1.0", v2, true, false},
+		{"missing tag", database, "github.com/Southclaws/TestVersions", "2.0.0", pawnpackage.Package{}, false, false},
+		{"missing package", database, "github.com/Southclaws/TestPackage1", "1.0.0", pawnpackage.Package{}, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotPkg, gotExists, err := tt.db.GetVersion(tt.pkg, tt.tag)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("DB.GetVersion() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(gotPkg, tt.wantPkg) {
+				t.Errorf("DB.GetVersion() gotPkg = %v, want %v", gotPkg, tt.wantPkg)
+			}
+			if gotExists != tt.wantExists {
+				t.Errorf("DB.GetVersion() gotExists = %v, want %v", gotExists, tt.wantExists)
+			}
+		})
+	}
+
+	all, err := database.GetVersions("github.com/Southclaws/TestVersions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(all, []pawnpackage.Package{v1, v2}) {
+		t.Errorf("DB.GetVersions() = %v", all)
+	}
+
+	// a scrape that read no definitions keeps the versions of tags that still exist, unless the tag
+	// was read at another commit
+	for _, tt := range []struct {
+		tags    []string
+		commits map[string]string
+		want    []pawnpackage.Package
+	}{
+		{[]string{"1.1.0", "1.0.0"}, nil, []pawnpackage.Package{v1, v2}},
+		{[]string{"1.1.0", "1.0.0"}, map[string]string{"1.0.0": "a", "1.1.0": "b"}, []pawnpackage.Package{v1, v2}},
+		{[]string{"1.1.0", "1.0.0"}, map[string]string{"1.0.0": "moved"}, []pawnpackage.Package{v2}},
+		{[]string{"1.1.0"}, nil, []pawnpackage.Package{v2}},
+		{nil, nil, []pawnpackage.Package{}},
+	} {
+		if err := database.Set(pawn.Package{
+			Package:        pawnpackage.Package{DependencyMeta: versioning.DependencyMeta{User: "Southclaws", Repo: "TestVersions"}},
+			Classification: pawn.ClassificationPawnPackage,
+			Tags:           tt.tags,
+			Commits:        tt.commits,
+		}); err != nil {
+			t.Fatal(err)
+		}
+		all, err := database.GetVersions("github.com/Southclaws/TestVersions")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(all, tt.want) {
+			t.Errorf("DB.GetVersions() with tags %v at %v = %v, want %v", tt.tags, tt.commits, all, tt.want)
+		}
+	}
+}
+
+func TestDB_Lookup(t *testing.T) {
+	pkg := pawn.Package{
+		Package: pawnpackage.Package{
+			DependencyMeta: versioning.DependencyMeta{
+				Site: pawn.DefaultSite,
+				User: "Southclaws",
+				Repo: "TestLookup",
+			},
+		},
+		Classification: pawn.ClassificationPawnPackage,
+	}
+	if err := database.Set(pkg); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		lookup     string
+		wantExists bool
+	}{
+		{"exact", "github.com/Southclaws/TestLookup", true},
+		{"case", "southclaws/testlookup", true},
+		{"missing", "github.com/Southclaws/TestLookupMissing", false},
+		{"invalid", "TestLookup", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, exists, err := database.Lookup(tt.lookup)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if exists != tt.wantExists || (exists && got.String() != pkg.String()) {
+				t.Errorf("DB.Lookup() = %s, %v, want %v", got.String(), exists, tt.wantExists)
+			}
+		})
+	}
+}
+
+func TestDB_GetDependents(t *testing.T) {
+	dependent := pawn.Package{
+		Package: pawnpackage.Package{
+			DependencyMeta: versioning.DependencyMeta{
+				User: "Southclaws",
+				Repo: "TestDependent",
+			},
+		},
+		Classification: pawn.ClassificationPawnPackage,
+		Requires: []versioning.DependencyMeta{
+			{Site: "github.com", User: "Southclaws", Repo: "TestPackage1"},
+			{Site: "github.com", User: "Southclaws", Repo: "TestPackage2", Tag: "1.0.0"},
+		},
+	}
+	if err := database.Set(dependent); err != nil {
+		t.Fatal(err)
+	}
+
+	// dropping a dependency must remove the package from that dependency's dependents
+	dependent.Requires = dependent.Requires[:1]
+	if err := database.Set(dependent); err != nil {
+		t.Fatal(err)
+	}
+
+	// packages stored before dependencies were parsed only have the dependency strings
+	legacy := pawn.Package{
+		Package: pawnpackage.Package{
+			DependencyMeta: versioning.DependencyMeta{
+				User: "Southclaws",
+				Repo: "TestLegacyDependent",
+			},
+			Dependencies: []versioning.DependencyString{"Southclaws/TestPackage3"},
+		},
+		Classification: pawn.ClassificationPawnPackage,
+	}
+	if err := database.Set(legacy); err != nil {
+		t.Fatal(err)
+	}
+
+	// dependencies are spelled however the dependent wrote them
+	lowercase := pawn.Package{
+		Package: pawnpackage.Package{
+			DependencyMeta: versioning.DependencyMeta{
+				User: "Southclaws",
+				Repo: "TestLowercaseDependent",
+			},
+		},
+		Classification: pawn.ClassificationPawnPackage,
+		Requires:       []versioning.DependencyMeta{{Site: "github.com", User: "southclaws", Repo: "testpackage4"}},
+	}
+	if err := database.Set(lowercase); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		db      *DB
+		pkg     string
+		want    []string
+		wantErr bool
+	}{
+		{"dependents", database, "github.com/Southclaws/TestPackage1", []string{"github.com/Southclaws/TestDependent"}, false},
+		{"legacy", database, "github.com/Southclaws/TestPackage3", []string{"github.com/Southclaws/TestLegacyDependent"}, false},
+		{"case", database, "github.com/Southclaws/TestPackage4", []string{"github.com/Southclaws/TestLowercaseDependent"}, false},
+		{"removed", database, "github.com/Southclaws/TestPackage2", []string{}, false},
+		{"none", database, "github.com/Southclaws/TestDependent", []string{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.db.GetDependents(tt.pkg)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("DB.GetDependents() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			names := []string{}
+			for _, p := range got {
+				names = append(names, p.String())
+			}
+			if !reflect.DeepEqual(names, tt.want) {
+				t.Errorf("DB.GetDependents() = %v, want %v", names, tt.want)
+			}
+		})
+	}
+}
+
+func TestDB_GetIncludes(t *testing.T) {
+	for _, p := range []pawn.Package{
+		{
+			Package: pawnpackage.Package{
+				DependencyMeta: versioning.DependencyMeta{
+					User: "pBlueG",
+					Repo: "SA-MP-MySQL",
+				},
+			},
+			Classification: pawn.ClassificationBarebones,
+			Stars:          200,
+			Includes:       []string{"a_mysql.inc"},
+		},
+		{
+			Package: pawnpackage.Package{
+				DependencyMeta: versioning.DependencyMeta{
+					User: "someone",
+					Repo: "mysql-fork",
+				},
+			},
+			Classification: pawn.ClassificationPawnPackage,
+			Stars:          2,
+			Includes:       []string{"include/A_MySQL.inc", "include/extra.inc"},
+		},
+	} {
+		if err := database.Set(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		db      *DB
+		include string
+		want    []Include
+		wantErr bool
+	}{
+		{"ranked", database, "a_mysql", []Include{
+			{"github.com/someone/mysql-fork", "include/A_MySQL.inc", pawn.ClassificationPawnPackage, 2},
+			{"github.com/pBlueG/SA-MP-MySQL", "a_mysql.inc", pawn.ClassificationBarebones, 200},
+		}, false},
+		{"extension", database, "extra.inc", []Include{
+			{"github.com/someone/mysql-fork", "include/extra.inc", pawn.ClassificationPawnPackage, 2},
+		}, false},
+		{"none", database, "a_samp", []Include{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.db.GetIncludes(tt.include)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("DB.GetIncludes() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DB.GetIncludes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDB_GetSymbols(t *testing.T) {
+	pkg := pawn.Package{
+		Package: pawnpackage.Package{
+			DependencyMeta: versioning.DependencyMeta{
+				User: "Southclaws",
+				Repo: "TestSymbols",
+			},
+		},
+		Classification: pawn.ClassificationPawnPackage,
+		Symbols: []pawn.Symbol{
+			{Name: "Test_Old", Kind: pawn.SymbolStock, Signature: "stock Test_Old()", Path: "test.inc", Line: 1},
+		},
+	}
+	if err := database.Set(pkg); err != nil {
+		t.Fatal(err)
+	}
+
+	// storing the package again must replace its symbols
+	pkg.Symbols = []pawn.Symbol{
+		{Name: "Test_Native", Kind: pawn.SymbolNative, Signature: "native Test_Native()", Path: "test.inc", Line: 1, Tag: "1.0.0"},
+	}
+	if err := database.Set(pkg); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		db      *DB
+		symbol  string
+		want    []SymbolDeclaration
+		wantErr bool
+	}{
+		{"native", database, "Test_Native", []SymbolDeclaration{{"github.com/Southclaws/TestSymbols", pkg.Symbols[0]}}, false},
+		{"replaced", database, "Test_Old", []SymbolDeclaration{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.db.GetSymbols(tt.symbol)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("DB.GetSymbols() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DB.GetSymbols() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDB_GetIndexedCommits(t *testing.T) {
+	const name = "github.com/Southclaws/TestIndexed"
+	head := pawn.Symbol{Name: "Test_Head", Kind: pawn.SymbolNative, Signature: "native Test_Head()", Path: "test.inc", Line: 1}
+	tagged := pawn.Symbol{Name: "Test_Tagged", Kind: pawn.SymbolNative, Signature: "native Test_Tagged()", Path: "test.inc", Line: 1, Tag: "1.0.0"}
+	pkg := pawn.Package{
+		Package: pawnpackage.Package{
+			DependencyMeta: versioning.DependencyMeta{
+				User: "Southclaws",
+				Repo: "TestIndexed",
+			},
+		},
+		Classification: pawn.ClassificationPawnPackage,
+		Tags:           []string{"1.0.0"},
+		Symbols:        []pawn.Symbol{head, tagged},
+		Commits:        map[string]string{"": "b", "1.0.0": "a"},
+	}
+
+	for _, tt := range []struct {
+		name        string
+		symbols     []pawn.Symbol
+		commits     map[string]string
+		wantCommits map[string]string
+		wantTagged  []SymbolDeclaration
+	}{
+		{"indexed", pkg.Symbols, pkg.Commits, pkg.Commits, []SymbolDeclaration{{name, tagged}}},
+		// a scrape that skipped the tag at the same commit keeps its symbols
+		{"skipped", []pawn.Symbol{head}, map[string]string{"": "c", "1.0.0": "a"}, map[string]string{"": "c", "1.0.0": "a"}, []SymbolDeclaration{{name, tagged}}},
+		// a tag read again at another commit replaces them
+		{"moved", []pawn.Symbol{head}, map[string]string{"": "c", "1.0.0": "d"}, map[string]string{"": "c", "1.0.0": "d"}, []SymbolDeclaration{}},
+		// and one that couldn't be read at all is dropped so it's read on the next scrape
+		{"unread", []pawn.Symbol{head}, map[string]string{"": "c"}, map[string]string{"": "c"}, []SymbolDeclaration{}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			pkg.Symbols, pkg.Commits = tt.symbols, tt.commits
+			if err := database.Set(pkg); err != nil {
+				t.Fatal(err)
+			}
+
+			commits, err := database.GetIndexedCommits(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(commits, tt.wantCommits) {
+				t.Errorf("DB.GetIndexedCommits() = %v, want %v", commits, tt.wantCommits)
+			}
+			got, err := database.GetSymbols("Test_Tagged")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.wantTagged) {
+				t.Errorf("DB.GetSymbols() = %v, want %v", got, tt.wantTagged)
+			}
+			got, err = database.GetSymbols("Test_Head")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != 1 {
+				t.Errorf("DB.GetSymbols() = %v, want the head's declaration", got)
+			}
+		})
+	}
+}
+
+func TestDB_GetConflicts(t *testing.T) {
+	for _, repo := range []string{"TestGuard1", "TestGuard2"} {
+		if err := database.Set(pawn.Package{
+			Package: pawnpackage.Package{
+				DependencyMeta: versioning.DependencyMeta{
+					User: "Southclaws",
+					Repo: repo,
+				},
+			},
+			Classification: pawn.ClassificationBarebones,
+			Symbols: []pawn.Symbol{
+				{Name: "_inc_test_guard", Kind: pawn.SymbolGuard, Signature: "#define _inc_test_guard", Path: repo + ".inc", Line: 4},
+			},
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	includeConflict := pawn.Conflict{
+		Kind:     pawn.ConflictInclude,
+		Name:     "a_mysql",
+		Packages: []string{"github.com/pBlueG/SA-MP-MySQL", "github.com/someone/mysql-fork"},
+	}
+	guardConflict := pawn.Conflict{
+		Kind:     pawn.ConflictGuard,
+		Name:     "_inc_test_guard",
+		Packages: []string{"github.com/Southclaws/TestGuard1", "github.com/Southclaws/TestGuard2"},
+	}
+
+	got, err := database.GetConflicts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []pawn.Conflict{includeConflict, guardConflict}; !reflect.DeepEqual(got, want) {
+		t.Errorf("DB.GetConflicts() = %v, want %v", got, want)
+	}
+
+	tests := []struct {
+		name    string
+		db      *DB
+		pkg     string
+		want    []pawn.Conflict
+		wantErr bool
+	}{
+		{"include", database, "github.com/someone/mysql-fork", []pawn.Conflict{includeConflict}, false},
+		{"guard", database, "github.com/Southclaws/TestGuard2", []pawn.Conflict{guardConflict}, false},
+		{"none", database, "github.com/Southclaws/TestPackage1", []pawn.Conflict{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.db.GetPackageConflicts(tt.pkg)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("DB.GetPackageConflicts() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DB.GetPackageConflicts() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDB_GetPackageConflicts_sharedName(t *testing.T) {
+	// an include and a guard with the same name are separate conflicts
+	for _, repo := range []string{"TestShared1", "TestShared2"} {
+		if err := database.Set(pawn.Package{
+			Package: pawnpackage.Package{
+				DependencyMeta: versioning.DependencyMeta{
+					User: "Southclaws",
+					Repo: repo,
+				},
+			},
+			Classification: pawn.ClassificationBarebones,
+			Includes:       []string{"test_shared.inc"},
+			Symbols: []pawn.Symbol{
+				{Name: "test_shared", Kind: pawn.SymbolGuard, Signature: "#define test_shared", Path: "test_shared.inc", Line: 1},
+			},
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	packages := []string{"github.com/Southclaws/TestShared1", "github.com/Southclaws/TestShared2"}
+	want := []pawn.Conflict{
+		{Kind: pawn.ConflictInclude, Name: "test_shared", Packages: packages},
+		{Kind: pawn.ConflictGuard, Name: "test_shared", Packages: packages},
+	}
+	got, err := database.GetPackageConflicts("github.com/Southclaws/TestShared1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("DB.GetPackageConflicts() = %v, want %v", got, want)
+	}
+}
+
+func TestDB_MigrateSites(t *testing.T) {
+	os.Remove("migrate.db")
+	defer os.Remove("migrate.db")
+
+	legacy := pawn.Package{
+		Package: pawnpackage.Package{
+			DependencyMeta: versioning.DependencyMeta{
+				User: "Southclaws",
+				Repo: "TestLegacy",
+			},
+		},
+		Classification: pawn.ClassificationPawnPackage,
+		Description:    "stored before hosts",
+		Updated:        storedNow,
+	}
+
+	// write an entry the way it was stored before names included the host
+	raw, err := bolt.Open("migrate.db", 0o666, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := raw.Update(func(t *bolt.Tx) error {
+		bkt, err := t.CreateBucketIfNotExists(packagesBucket)
+		if err != nil {
+			return err
+		}
+		e, err := json.Marshal(Entry{Pkg: legacy})
+		if err != nil {
+			return err
+		}
+		return bkt.Put([]byte("Southclaws/TestLegacy"), e)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	raw.Close()
+
+	db, err := New("migrate.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	legacy.Site = pawn.DefaultSite
+
+	got, exists, err := db.Get("github.com/Southclaws/TestLegacy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !exists || !reflect.DeepEqual(got, legacy) {
+		t.Errorf("DB.Get() = %v, %v, want %v", got, exists, legacy)
+	}
+
+	results, err := db.Search("hosts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].String() != "github.com/Southclaws/TestLegacy" {
+		t.Errorf("DB.Search() = %v", results)
+	}
+}
+
+func TestDB_MigrateSymbols(t *testing.T) {
+	os.Remove("migrate.db")
+	defer os.Remove("migrate.db")
+
+	const name = "github.com/Southclaws/TestLegacySymbols"
+	legacy := pawn.Package{
+		Package: pawnpackage.Package{
+			DependencyMeta: versioning.DependencyMeta{
+				Site: pawn.DefaultSite,
+				User: "Southclaws",
+				Repo: "TestLegacySymbols",
+			},
+		},
+		Classification: pawn.ClassificationPawnPackage,
+		Tags:           []string{"1.0.0"},
+	}
+	symbols := []pawn.Symbol{
+		{Name: "Legacy_Head", Kind: pawn.SymbolNative, Signature: "native Legacy_Head()", Path: "test.inc", Line: 1},
+		{Name: "Legacy_Tagged", Kind: pawn.SymbolNative, Signature: "native Legacy_Tagged()", Path: "test.inc", Line: 2, Tag: "1.0.0"},
+	}
+
+	// write symbols the way they were stored before they were stored per tag
+	raw, err := bolt.Open("migrate.db", 0o666, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := raw.Update(func(t *bolt.Tx) error {
+		bkt, err := t.CreateBucketIfNotExists(packagesBucket)
+		if err != nil {
+			return err
+		}
+		e, err := json.Marshal(Entry{Pkg: legacy})
+		if err != nil {
+			return err
+		}
+		if err := bkt.Put([]byte(name), e); err != nil {
+			return err
+		}
+		pkgSymbols, err := t.CreateBucketIfNotExists(packageSymbolsBucket)
+		if err != nil {
+			return err
+		}
+		s, err := json.Marshal(symbols)
+		if err != nil {
+			return err
+		}
+		return pkgSymbols.Put([]byte(name), s)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	raw.Close()
+
+	db, err := New("migrate.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for _, s := range symbols {
+		got, err := db.GetSymbols(s.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []SymbolDeclaration{{name, s}}; !reflect.DeepEqual(got, want) {
+			t.Errorf("DB.GetSymbols() = %v, want %v", got, want)
+		}
+	}
+
+	// the commits weren't recorded so every tag is read again
+	commits, err := db.GetIndexedCommits(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(commits) != 0 {
+		t.Errorf("DB.GetIndexedCommits() = %v, want none", commits)
+	}
+}
+
+func TestDB_MigrateDependents(t *testing.T) {
+	os.Remove("migrate.db")
+	defer os.Remove("migrate.db")
+
+	db, err := New("migrate.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dependent := pawn.Package{
+		Package: pawnpackage.Package{
+			DependencyMeta: versioning.DependencyMeta{
+				Site: pawn.DefaultSite,
+				User: "Southclaws",
+				Repo: "TestDependent",
+			},
+		},
+		Classification: pawn.ClassificationPawnPackage,
+		Requires:       []versioning.DependencyMeta{{Site: "github.com", User: "Southclaws", Repo: "TestPackage"}},
+	}
+	if err := db.Set(dependent); err != nil {
+		t.Fatal(err)
+	}
+
+	// key the dependent the way it was keyed before keys were lowercase
+	if err := db.db.Update(func(t *bolt.Tx) error {
+		bkt := t.Bucket(dependentsBucket)
+		raw := bkt.Get([]byte("github.com/southclaws/testpackage"))
+		if err := bkt.Delete([]byte("github.com/southclaws/testpackage")); err != nil {
+			return err
+		}
+		return bkt.Put([]byte("github.com/Southclaws/TestPackage"), raw)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	db, err = New("migrate.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	got, err := db.GetDependents("github.com/Southclaws/TestPackage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].String() != dependent.String() {
+		t.Errorf("DB.GetDependents() = %v, want %s", got, dependent.String())
+	}
+}
+
+func TestDB_Coverage(t *testing.T) {
+	old := pawn.SearchCoverage{Site: "github.com", Query: "language:pawn", Total: 10, Found: 5, Time: storedNow}
+	latest := pawn.SearchCoverage{Site: "github.com", Query: "language:pawn", Total: 3000, Found: 3000, Slices: 4, Time: storedNow}
+	other := pawn.SearchCoverage{Site: "github.com", Query: "topic:sa-mp", Total: 20, Found: 20, Slices: 1, Time: storedNow}
+	for _, c := range []pawn.SearchCoverage{old, latest, other} {
+		if err := database.SetCoverage(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := database.GetCoverage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []pawn.SearchCoverage{latest, other}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("DB.GetCoverage() = %v, want %v", got, want)
+	}
+}
+
+func TestDB_Queries(t *testing.T) {
+	pawnQuery := QueryState{Query: "language:pawn", Interval: time.Hour, LastRun: storedNow, Hits: 10}
+	topicQuery := QueryState{Query: "topic:open-mp", LastRun: storedNow, Last: storedNow, LastFull: storedNow, Full: true, Hits: 2}
+	for _, q := range []QueryState{pawnQuery, topicQuery} {
+		if err := database.SetQuery(q); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pawnQuery.Hits = 20
+	pawnQuery.Error = "failed"
+	if err := database.SetQuery(pawnQuery); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := database.GetQueries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []QueryState{pawnQuery, topicQuery}; !reflect.DeepEqual(got, want) {
+		t.Errorf("DB.GetQueries() = %v, want %v", got, want)
+	}
+
+	if err := database.DeleteQuery("topic:open-mp"); err != nil {
+		t.Fatal(err)
+	}
+	got, err = database.GetQueries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []QueryState{pawnQuery}; !reflect.DeepEqual(got, want) {
+		t.Errorf("DB.GetQueries() = %v, want %v", got, want)
+	}
+}
+
+func TestDB_GetUnindexedDependencies(t *testing.T) {
+	pkg := func(repo string, requires ...string) pawn.Package {
+		p := pawn.Package{
+			Package: pawnpackage.Package{
+				DependencyMeta: versioning.DependencyMeta{Site: "github.com", User: "Crawl", Repo: repo},
+			},
+			Classification: pawn.ClassificationPawnPackage,
+		}
+		for _, r := range requires {
+			p.Requires = append(p.Requires, versioning.DependencyMeta{Site: "github.com", User: "Crawl", Repo: r})
+		}
+		return p
+	}
+
+	// Root was found by searching and requires Indexed, which is indexed, and Child which isn't
+	if err := database.MarkForScrape("Crawl/Root"); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []pawn.Package{pkg("Root", "Indexed", "Child"), pkg("Indexed")} {
+		if err := database.Set(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := database.GetUnindexedDependencies(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Dependency{{Name: "github.com/Crawl/Child", Depth: 1, RequiredBy: "github.com/Crawl/Root"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("DB.GetUnindexedDependencies() = %v, want %v", got, want)
+	}
+
+	// once marked, Child is scraped and its own dependency is found one level deeper
+	if err := database.MarkDependency(got[0]); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := database.GetUnindexedDependencies(2); err != nil || len(got) != 0 {
+		t.Errorf("DB.GetUnindexedDependencies() = %v, %v, want marked dependency left out", got, err)
+	}
+	if err := database.Set(pkg("Child", "Grandchild")); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err = database.GetUnindexedDependencies(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []Dependency{{Name: "github.com/Crawl/Grandchild", Depth: 2, RequiredBy: "github.com/Crawl/Child"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("DB.GetUnindexedDependencies() = %v, want %v", got, want)
+	}
+
+	// Grandchild is at the depth limit, so its dependencies aren't crawled
+	if err := database.MarkDependency(got[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.Set(pkg("Grandchild", "Leaf")); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := database.GetUnindexedDependencies(2); err != nil || len(got) != 0 {
+		t.Errorf("DB.GetUnindexedDependencies() = %v, %v, want nothing past the depth limit", got, err)
+	}
+}
+
+func TestDB_GetDiscovery(t *testing.T) {
+	search := Discovery{Source: SourceSearch, Query: "topic:pawn-package", Time: storedNow}
+	code := Discovery{Source: SourceCodeSearch, Query: "filename:pawn.json", Time: storedNow}
+	for _, d := range []Discovery{search, code, search} {
+		if err := database.MarkFound("Southclaws/TestDiscovery", d); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// scraping the package must keep how it was found
+	if err := database.Set(pawn.Package{
+		Package: pawnpackage.Package{
+			DependencyMeta: versioning.DependencyMeta{User: "Southclaws", Repo: "TestDiscovery"},
+		},
+		Classification: pawn.ClassificationPawnPackage,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := database.GetDiscovery("Southclaws/TestDiscovery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []Discovery{search, code}; !reflect.DeepEqual(got, want) {
+		t.Errorf("DB.GetDiscovery() = %v, want %v", got, want)
+	}
+}
+
+func TestDB_Submit(t *testing.T) {
+	accepted, err := database.Submit("Southclaws/TestSubmitted")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rejected, err := database.Submit("github.com/Southclaws/TestRejected")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if accepted.Status != SubmissionQueued || accepted.Package != "github.com/Southclaws/TestSubmitted" {
+		t.Errorf("DB.Submit() = %v, want a queued submission", accepted)
+	}
+
+	// submitting a repository that's still queued returns the pending submission
+	again, err := database.Submit("github.com/Southclaws/TestSubmitted")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != accepted {
+		t.Errorf("DB.Submit() again = %v, want %v", again, accepted)
+	}
+
+	// submissions are scraped before anything else that's marked
+	marked, err := database.GetMarked()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(marked) < 2 || marked[0] != "github.com/Southclaws/TestRejected" || marked[1] != "github.com/Southclaws/TestSubmitted" {
+		t.Errorf("DB.GetMarked() = %v, want submissions first", marked)
+	}
+
+	if err := database.Set(pawn.Package{
+		Package: pawnpackage.Package{
+			DependencyMeta: versioning.DependencyMeta{Site: "github.com", User: "Southclaws", Repo: "TestSubmitted"},
+		},
+		Classification: pawn.ClassificationPawnPackage,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.RejectSubmissions("Southclaws/TestRejected", "not a package"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		id         string
+		wantStatus SubmissionStatus
+		wantReason string
+		wantExists bool
+	}{
+		{accepted.ID, SubmissionScraped, "", true},
+		{rejected.ID, SubmissionRejected, "not a package", true},
+		{"missing", "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			got, exists, err := database.GetSubmission(tt.id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if exists != tt.wantExists || got.Status != tt.wantStatus || got.Reason != tt.wantReason {
+				t.Errorf("DB.GetSubmission() = %v, %v, want status %v reason %q", got, exists, tt.wantStatus, tt.wantReason)
+			}
+		})
+	}
+
+	discovery, err := database.GetDiscovery("Southclaws/TestSubmitted")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(discovery) != 1 || discovery[0].Source != SourceSubmission {
+		t.Errorf("DB.GetDiscovery() = %v, want a submission", discovery)
+	}
+}
+
+func TestDB_Delete(t *testing.T) {
+	if err := database.Set(pawn.Package{
+		Package: pawnpackage.Package{
+			DependencyMeta: versioning.DependencyMeta{Site: "github.com", User: "Southclaws", Repo: "TestDeleted"},
+		},
+		Classification: pawn.ClassificationPawnPackage,
+		Description:    "deletable",
+		Versions:       []pawnpackage.Package{{DependencyMeta: versioning.DependencyMeta{Tag: "1.0.0"}}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	submission, err := database.Submit("Southclaws/TestDeleted")
+	if err != nil {
+		t.Fatal(err)
+	}
+	responses := map[string]bool{
+		"https://api.github.com/repos/Southclaws/TestDeleted ":                          false,
+		"https://api.github.com/repos/southclaws/testdeleted/contents/pawn.json?ref=x ": false,
+		"https://api.github.com/repos/Southclaws/TestDeletedToo ":                       true,
+	}
+	for key := range responses {
+		if err := database.SetResponse(key, []byte("{}")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := database.Delete("Southclaws/TestDeleted"); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.Delete("Southclaws/TestNeverExisted"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, exists, err := database.Get("Southclaws/TestDeleted"); err != nil || exists {
+		t.Errorf("DB.Get() exists = %v, %v, want deleted", exists, err)
+	}
+	if versions, err := database.GetVersions("Southclaws/TestDeleted"); err != nil || len(versions) != 0 {
+		t.Errorf("DB.GetVersions() = %v, %v, want none", versions, err)
+	}
+	if results, err := database.Search("deletable"); err != nil || len(results) != 0 {
+		t.Errorf("DB.Search() = %v, %v, want none", results, err)
+	}
+	if got, _, err := database.GetSubmission(submission.ID); err != nil || got.Status != SubmissionRejected {
+		t.Errorf("DB.GetSubmission() = %v, %v, want rejected", got, err)
+	}
+	for key, want := range responses {
+		if _, exists, err := database.GetResponse(key); err != nil || exists != want {
+			t.Errorf("DB.GetResponse(%q) exists = %v, %v, want %v", key, exists, err, want)
+		}
+	}
+}
+
+func TestDB_Responses(t *testing.T) {
+	if _, exists, err := database.GetResponse("https://api.github.com/repos/a/b"); err != nil || exists {
+		t.Errorf("DB.GetResponse() exists = %v, %v, want nothing cached", exists, err)
+	}
+	for _, raw := range []string{`{"etag":"1"}`, `{"etag":"2"}`} {
+		if err := database.SetResponse("https://api.github.com/repos/a/b", []byte(raw)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, exists, err := database.GetResponse("https://api.github.com/repos/a/b")
+	if err != nil || !exists || string(got) != `{"etag":"2"}` {
+		t.Errorf("DB.GetResponse() = %s, %v, %v, want the latest response", got, exists, err)
+	}
+}
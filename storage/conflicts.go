@@ -0,0 +1,155 @@
+package storage
+
+import (
+	"encoding/json"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/Southclaws/pawndex/pawn"
+)
+
+// GetConflicts returns every include file name and include guard that is shared by more than one
+// package in the index.
+func (db *DB) GetConflicts() ([]pawn.Conflict, error) {
+	conflicts := []pawn.Conflict{}
+
+	if err := db.db.View(func(t *bolt.Tx) error {
+		if err := t.Bucket(includesBucket).ForEach(func(k, v []byte) error {
+			c, err := includeConflict(string(k), v)
+			if err != nil || c == nil {
+				return err
+			}
+			conflicts = append(conflicts, *c)
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		guards := t.Bucket(guardsBucket)
+		if guards == nil {
+			return nil
+		}
+		return guards.ForEach(func(k, v []byte) error {
+			c, err := guardConflict(string(k), v)
+			if err != nil || c == nil {
+				return err
+			}
+			conflicts = append(conflicts, *c)
+			return nil
+		})
+	}); err != nil {
+		return nil, err
+	}
+	return conflicts, nil
+}
+
+// GetPackageConflicts returns the include file names and include guards of a package that are also
+// used by other packages.
+func (db *DB) GetPackageConflicts(name string) ([]pawn.Conflict, error) {
+	name = pawn.CanonicalName(name)
+
+	conflicts := []pawn.Conflict{}
+
+	if err := db.db.View(func(t *bolt.Tx) error {
+		raw := t.Bucket(packagesBucket).Get([]byte(name))
+		if raw == nil {
+			return nil
+		}
+		var e Entry
+		if err := json.Unmarshal(raw, &e); err != nil {
+			return err
+		}
+
+		includes := t.Bucket(includesBucket)
+		seenIncludes := map[string]bool{}
+		for _, p := range e.Pkg.Includes {
+			key := includeName(p)
+			if seenIncludes[key] {
+				continue
+			}
+			seenIncludes[key] = true
+
+			c, err := includeConflict(key, includes.Get([]byte(key)))
+			if err != nil {
+				return err
+			}
+			if c != nil {
+				conflicts = append(conflicts, *c)
+			}
+		}
+
+		guards := t.Bucket(guardsBucket)
+		pkgSymbols := t.Bucket(packageSymbolsBucket)
+		if guards == nil || pkgSymbols == nil {
+			return nil
+		}
+		sets := pkgSymbols.Bucket([]byte(name))
+		if sets == nil {
+			return nil
+		}
+		raw = sets.Get([]byte(headKey))
+		if raw == nil {
+			return nil
+		}
+		var head symbolSet
+		if err := json.Unmarshal(raw, &head); err != nil {
+			return err
+		}
+		// include names and guard names can coincide, so each kind is deduplicated on its own
+		seenGuards := map[string]bool{}
+		for _, s := range head.Symbols {
+			if s.Kind != pawn.SymbolGuard || seenGuards[s.Name] {
+				continue
+			}
+			seenGuards[s.Name] = true
+
+			c, err := guardConflict(s.Name, guards.Get([]byte(s.Name)))
+			if err != nil {
+				return err
+			}
+			if c != nil {
+				conflicts = append(conflicts, *c)
+			}
+		}
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return conflicts, nil
+}
+
+// includeConflict returns a conflict if the include is provided by more than one package
+func includeConflict(name string, raw []byte) (*pawn.Conflict, error) {
+	if raw == nil {
+		return nil, nil
+	}
+	var refs []includeRef
+	if err := json.Unmarshal(raw, &refs); err != nil {
+		return nil, err
+	}
+
+	var packages []string
+	for _, r := range refs {
+		packages = insertString(packages, r.Package)
+	}
+	if len(packages) < 2 {
+		return nil, nil
+	}
+	return &pawn.Conflict{Kind: pawn.ConflictInclude, Name: name, Packages: packages}, nil
+}
+
+// guardConflict returns a conflict if the guard is defined by more than one package
+func guardConflict(name string, raw []byte) (*pawn.Conflict, error) {
+	if raw == nil {
+		return nil, nil
+	}
+	var packages []string
+	if err := json.Unmarshal(raw, &packages); err != nil {
+		return nil, err
+	}
+	if len(packages) < 2 {
+		return nil, nil
+	}
+	return &pawn.Conflict{Kind: pawn.ConflictGuard, Name: name, Packages: packages}, nil
+}
@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"encoding/json"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/Southclaws/pawndex/pawn"
+)
+
+// coverageBucket holds the coverage of the latest search of each query, keyed by site and query
+var coverageBucket = []byte("coverage")
+
+// SetCoverage records the coverage of a search, replacing the previous search of the same query
+func (db *DB) SetCoverage(c pawn.SearchCoverage) error {
+	return db.db.Update(func(t *bolt.Tx) error {
+		bkt, err := t.CreateBucketIfNotExists(coverageBucket)
+		if err != nil {
+			return err
+		}
+		raw, err := json.Marshal(c)
+		if err != nil {
+			return err
+		}
+		return bkt.Put([]byte(c.Site+" "+c.Query), raw)
+	})
+}
+
+// GetCoverage returns the coverage of the latest search of every query
+func (db *DB) GetCoverage() ([]pawn.SearchCoverage, error) {
+	coverage := []pawn.SearchCoverage{}
+
+	if err := db.db.View(func(t *bolt.Tx) error {
+		bkt := t.Bucket(coverageBucket)
+		if bkt == nil {
+			return nil
+		}
+		return bkt.ForEach(func(k, v []byte) error {
+			var c pawn.SearchCoverage
+			if err := json.Unmarshal(v, &c); err != nil {
+				return err
+			}
+			coverage = append(coverage, c)
+			return nil
+		})
+	}); err != nil {
+		return nil, err
+	}
+	return coverage, nil
+}
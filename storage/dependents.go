@@ -0,0 +1,151 @@
+package storage
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/Southclaws/sampctl/versioning"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/Southclaws/pawndex/pawn"
+)
+
+// dependentsBucket maps a lowercase package name to the names of the packages that depend on it.
+// Dependencies are spelled however the dependent wrote them, so they're matched regardless of case.
+var dependentsBucket = []byte("dependents")
+
+// dependentsKey returns the key of a package in the dependents bucket
+func dependentsKey(name string) string {
+	return strings.ToLower(name)
+}
+
+// legacyDependents reports whether the dependents bucket has keys from before they were lowercase
+func legacyDependents(t *bolt.Tx) bool {
+	bkt := t.Bucket(dependentsBucket)
+	if bkt == nil {
+		return false
+	}
+	c := bkt.Cursor()
+	for k, _ := c.First(); k != nil; k, _ = c.Next() {
+		if string(k) != strings.ToLower(string(k)) {
+			return true
+		}
+	}
+	return false
+}
+
+func updateDependents(t *bolt.Tx, old, new pawn.Package) error {
+	bkt, err := t.CreateBucketIfNotExists(dependentsBucket)
+	if err != nil {
+		return err
+	}
+
+	for _, dep := range requires(old) {
+		if err := updateList(bkt, dependentsKey(pawn.Name(dep.Site, dep.User, dep.Repo)), func(names []string) []string {
+			return removeString(names, old.String())
+		}); err != nil {
+			return err
+		}
+	}
+	if new.Repo == "" {
+		return nil
+	}
+	for _, dep := range requires(new) {
+		if err := updateList(bkt, dependentsKey(pawn.Name(dep.Site, dep.User, dep.Repo)), func(names []string) []string {
+			return insertString(names, new.String())
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// requires returns the dependencies of a package, packages stored before Requires was added only
+// have the dependency strings
+func requires(p pawn.Package) []versioning.DependencyMeta {
+	if len(p.Requires) > 0 {
+		return p.Requires
+	}
+	return pawn.ParseDependencies(p.GetAllDependencies())
+}
+
+// updateList reads a JSON list of strings, applies fn to it and writes it back, empty lists are
+// removed.
+func updateList(bkt *bolt.Bucket, key string, fn func([]string) []string) error {
+	var list []string
+	if raw := bkt.Get([]byte(key)); raw != nil {
+		if err := json.Unmarshal(raw, &list); err != nil {
+			return err
+		}
+	}
+
+	list = fn(list)
+
+	if len(list) == 0 {
+		return bkt.Delete([]byte(key))
+	}
+	raw, err := json.Marshal(list)
+	if err != nil {
+		return err
+	}
+	return bkt.Put([]byte(key), raw)
+}
+
+// insertString adds s to a sorted list if it's not already present
+func insertString(list []string, s string) []string {
+	i := sort.SearchStrings(list, s)
+	if i < len(list) && list[i] == s {
+		return list
+	}
+	list = append(list, "")
+	copy(list[i+1:], list[i:])
+	list[i] = s
+	return list
+}
+
+// removeString removes s from a sorted list
+func removeString(list []string, s string) []string {
+	i := sort.SearchStrings(list, s)
+	if i < len(list) && list[i] == s {
+		return append(list[:i], list[i+1:]...)
+	}
+	return list
+}
+
+// GetDependents returns the packages that depend on the given package
+func (db *DB) GetDependents(name string) ([]pawn.Package, error) {
+	name = pawn.CanonicalName(name)
+
+	packages := []pawn.Package{}
+
+	if err := db.db.View(func(t *bolt.Tx) error {
+		raw := t.Bucket(dependentsBucket).Get([]byte(dependentsKey(name)))
+		if raw == nil {
+			return nil
+		}
+
+		var names []string
+		if err := json.Unmarshal(raw, &names); err != nil {
+			return err
+		}
+
+		pkgs := t.Bucket(packagesBucket)
+		for _, n := range names {
+			raw := pkgs.Get([]byte(n))
+			if raw == nil {
+				continue
+			}
+			var e Entry
+			if err := json.Unmarshal(raw, &e); err != nil {
+				return err
+			}
+			packages = append(packages, e.Pkg)
+		}
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return packages, nil
+}
@@ -0,0 +1,153 @@
+package storage
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/Southclaws/pawndex/pawn"
+)
+
+// Source is a way of discovering repositories
+type Source string
+
+var (
+	SourceSearch     Source = "search"      // repository search queries
+	SourceCodeSearch Source = "code_search" // code search queries for package definition files
+	SourceDependency Source = "dependency"  // the dependencies of indexed packages
+	SourceSubmission Source = "submission"  // submitted by hand
+	SourceWebhook    Source = "webhook"     // named by a webhook event
+)
+
+// Discovery records how a repository was found
+type Discovery struct {
+	Source     Source    `json:"source"`
+	Query      string    `json:"query,omitempty"`       // the query that found it, for searches
+	RequiredBy string    `json:"required_by,omitempty"` // the package that requires it, for dependencies
+	Time       time.Time `json:"time"`                  // when it was first found this way
+}
+
+// addDiscovery records a way the entry was found, unless it has already been found that way
+func (e *Entry) addDiscovery(d Discovery) {
+	for _, existing := range e.Discovery {
+		if existing.Source == d.Source && existing.Query == d.Query && existing.RequiredBy == d.RequiredBy {
+			return
+		}
+	}
+	if d.Time.IsZero() {
+		d.Time = time.Now().UTC()
+	}
+	e.Discovery = append(e.Discovery, d)
+}
+
+// GetDiscovery returns each way a repository was found
+func (db *DB) GetDiscovery(name string) ([]Discovery, error) {
+	name = pawn.CanonicalName(name)
+
+	discovery := []Discovery{}
+	if err := db.db.View(func(t *bolt.Tx) error {
+		raw := t.Bucket(packagesBucket).Get([]byte(name))
+		if raw == nil {
+			return nil
+		}
+		var e Entry
+		if err := json.Unmarshal(raw, &e); err != nil {
+			return err
+		}
+		discovery = append(discovery, e.Discovery...)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return discovery, nil
+}
+
+// Dependency is a repository required by an indexed package that isn't in the index itself
+type Dependency struct {
+	Name       string `json:"name"`
+	Depth      int    `json:"depth"`       // dependency distance from a package found by searching
+	RequiredBy string `json:"required_by"` // one of the packages that requires it
+}
+
+// GetUnindexedDependencies returns the dependencies of indexed packages that aren't indexed, or
+// marked for scraping, themselves. Dependencies deeper than maxDepth are left out, so a package
+// found through a chain of dependencies can't lead the crawl arbitrarily far from the packages
+// found by searching. Shallower dependencies are listed first. Names are compared regardless of
+// case, as hosts do, since dependencies aren't always spelled the way the host spells them.
+func (db *DB) GetUnindexedDependencies(maxDepth int) ([]Dependency, error) {
+	found := map[string]Dependency{}
+
+	if err := db.db.View(func(t *bolt.Tx) error {
+		bkt := t.Bucket(packagesBucket)
+		known := map[string]bool{}
+		if err := bkt.ForEach(func(k, v []byte) error {
+			known[strings.ToLower(string(k))] = true
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		return bkt.ForEach(func(k, v []byte) error {
+			var e Entry
+			if err := json.Unmarshal(v, &e); err != nil {
+				return err
+			}
+			if e.Pkg.Repo == "" || e.Depth >= maxDepth {
+				return nil
+			}
+
+			for _, dep := range requires(e.Pkg) {
+				name := pawn.Name(dep.Site, dep.User, dep.Repo)
+				key := strings.ToLower(name)
+				if known[key] {
+					continue
+				}
+				if d, ok := found[key]; ok && d.Depth <= e.Depth+1 {
+					continue
+				}
+				found[key] = Dependency{Name: name, Depth: e.Depth + 1, RequiredBy: string(k)}
+			}
+			return nil
+		})
+	}); err != nil {
+		return nil, err
+	}
+
+	dependencies := []Dependency{}
+	for _, d := range found {
+		dependencies = append(dependencies, d)
+	}
+	sort.Slice(dependencies, func(i, j int) bool {
+		if dependencies[i].Depth != dependencies[j].Depth {
+			return dependencies[i].Depth < dependencies[j].Depth
+		}
+		return dependencies[i].Name < dependencies[j].Name
+	})
+	return dependencies, nil
+}
+
+// MarkDependency marks a dependency for scraping at its depth, unless it's already known
+func (db *DB) MarkDependency(d Dependency) error {
+	name := pawn.CanonicalName(d.Name)
+
+	return db.db.Update(func(t *bolt.Tx) error {
+		bkt, err := t.CreateBucketIfNotExists(packagesBucket)
+		if err != nil {
+			return err
+		}
+		if bkt.Get([]byte(name)) != nil {
+			return nil
+		}
+
+		e := Entry{Marked: true, Depth: d.Depth}
+		e.addDiscovery(Discovery{Source: SourceDependency, RequiredBy: d.RequiredBy})
+		raw, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		return bkt.Put([]byte(name), raw)
+	})
+}
@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"encoding/json"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/Southclaws/pawndex/pawn"
+)
+
+// Failure records the failed scrapes of a repository since it was last scraped successfully
+type Failure struct {
+	Name        string    `json:"name"`
+	Error       string    `json:"error"`        // error of the last attempt
+	Attempts    int       `json:"attempts"`     // failed attempts in a row
+	Last        time.Time `json:"last"`         // time of the last attempt
+	NextAttempt time.Time `json:"next_attempt"` // the repository isn't scraped again before this
+	Dead        bool      `json:"dead"`         // failed too often to be retried
+}
+
+// waiting reports whether a repository with this failure shouldn't be scraped yet
+func (f *Failure) waiting(now time.Time) bool {
+	return f != nil && (f.Dead || now.Before(f.NextAttempt))
+}
+
+// GetFailure returns the failure recorded for a repository, if its last scrape failed
+func (db *DB) GetFailure(name string) (f Failure, exists bool, err error) {
+	name = pawn.CanonicalName(name)
+
+	err = db.db.View(func(t *bolt.Tx) error {
+		raw := t.Bucket(packagesBucket).Get([]byte(name))
+		if raw == nil {
+			return nil
+		}
+		var e Entry
+		if err := json.Unmarshal(raw, &e); err != nil {
+			return err
+		}
+		if e.Failure != nil {
+			f, exists = *e.Failure, true
+		}
+		return nil
+	})
+	return
+}
+
+// SetFailure records a failed scrape of a repository, a dead repository is unmarked so it's only
+// scraped again once it's submitted again. The failure is cleared when the repository is next
+// stored.
+func (db *DB) SetFailure(name string, f Failure) error {
+	name = pawn.CanonicalName(name)
+	f.Name = name
+
+	return db.db.Update(func(t *bolt.Tx) error {
+		bkt := t.Bucket(packagesBucket)
+		raw := bkt.Get([]byte(name))
+		if raw == nil {
+			return nil
+		}
+
+		var e Entry
+		if err := json.Unmarshal(raw, &e); err != nil {
+			return err
+		}
+		e.Failure = &f
+		if f.Dead {
+			e.Marked = false
+		}
+
+		raw, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		return bkt.Put([]byte(name), raw)
+	})
+}
+
+// GetFailures returns the failure of every repository whose last scrape failed
+func (db *DB) GetFailures() ([]Failure, error) {
+	failures := []Failure{}
+
+	if err := db.db.View(func(t *bolt.Tx) error {
+		return t.Bucket(packagesBucket).ForEach(func(k, v []byte) error {
+			var e Entry
+			if err := json.Unmarshal(v, &e); err != nil {
+				return err
+			}
+			if e.Failure != nil {
+				failures = append(failures, *e.Failure)
+			}
+			return nil
+		})
+	}); err != nil {
+		return nil, err
+	}
+	return failures, nil
+}
@@ -0,0 +1,148 @@
+package storage
+
+import (
+	"encoding/json"
+	"path"
+	"sort"
+	"strings"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/Southclaws/pawndex/pawn"
+)
+
+// includesBucket maps an include name to every file in the index that provides it
+var includesBucket = []byte("includes")
+
+// Include is a file that provides an include name, for example `a_mysql` is provided by
+// `a_mysql.inc` inside pBlueG/SA-MP-MySQL.
+type Include struct {
+	Package        string              `json:"package"`
+	Path           string              `json:"path"`
+	Classification pawn.Classification `json:"classification"`
+	Stars          int                 `json:"stars"`
+}
+
+// includeName normalises an include path or directive argument to the key it's indexed under. The
+// Pawn compiler resolves `#include <a_mysql>` to a_mysql.inc and filesystems on Windows, where most
+// servers are developed, are case-insensitive.
+func includeName(p string) string {
+	p = path.Base(strings.Replace(p, "\\", "/", -1))
+	return strings.ToLower(strings.TrimSuffix(p, ".inc"))
+}
+
+// includeRef is the stored form of an Include
+type includeRef struct {
+	Package string `json:"package"`
+	Path    string `json:"path"`
+}
+
+func updateIncludes(t *bolt.Tx, old, new pawn.Package) error {
+	bkt, err := t.CreateBucketIfNotExists(includesBucket)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range old.Includes {
+		if err := updateIncludeRefs(bkt, includeName(p), func(refs []includeRef) []includeRef {
+			result := refs[:0]
+			for _, r := range refs {
+				if r.Package != old.String() {
+					result = append(result, r)
+				}
+			}
+			return result
+		}); err != nil {
+			return err
+		}
+	}
+	if new.Repo == "" {
+		return nil
+	}
+	for _, p := range new.Includes {
+		ref := includeRef{new.String(), p}
+		if err := updateIncludeRefs(bkt, includeName(p), func(refs []includeRef) []includeRef {
+			for _, r := range refs {
+				if r == ref {
+					return refs
+				}
+			}
+			return append(refs, ref)
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func updateIncludeRefs(bkt *bolt.Bucket, key string, fn func([]includeRef) []includeRef) error {
+	var refs []includeRef
+	if raw := bkt.Get([]byte(key)); raw != nil {
+		if err := json.Unmarshal(raw, &refs); err != nil {
+			return err
+		}
+	}
+
+	refs = fn(refs)
+
+	if len(refs) == 0 {
+		return bkt.Delete([]byte(key))
+	}
+	raw, err := json.Marshal(refs)
+	if err != nil {
+		return err
+	}
+	return bkt.Put([]byte(key), raw)
+}
+
+// GetIncludes returns the files that provide an include name, ranked by classification and stars
+func (db *DB) GetIncludes(name string) ([]Include, error) {
+	includes := []Include{}
+
+	if err := db.db.View(func(t *bolt.Tx) error {
+		raw := t.Bucket(includesBucket).Get([]byte(includeName(name)))
+		if raw == nil {
+			return nil
+		}
+
+		var refs []includeRef
+		if err := json.Unmarshal(raw, &refs); err != nil {
+			return err
+		}
+
+		pkgs := t.Bucket(packagesBucket)
+		for _, r := range refs {
+			raw := pkgs.Get([]byte(r.Package))
+			if raw == nil {
+				continue
+			}
+			var e Entry
+			if err := json.Unmarshal(raw, &e); err != nil {
+				return err
+			}
+			includes = append(includes, Include{
+				Package:        r.Package,
+				Path:           r.Path,
+				Classification: e.Pkg.Classification,
+				Stars:          e.Pkg.Stars,
+			})
+		}
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(includes, func(i, j int) bool {
+		ri, rj := includes[i].Classification.Rank(), includes[j].Classification.Rank()
+		if ri != rj {
+			return ri > rj
+		}
+		if includes[i].Stars != includes[j].Stars {
+			return includes[i].Stars > includes[j].Stars
+		}
+		return includes[i].Package < includes[j].Package
+	})
+
+	return includes, nil
+}
@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"encoding/json"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/Southclaws/pawndex/pawn"
+)
+
+// indexer keeps one or more secondary buckets in sync with the packages bucket. The update
+// function is called with the previous and the new version of a package whenever one is written,
+// either may be empty.
+type indexer struct {
+	buckets [][]byte
+	update  func(t *bolt.Tx, old, new pawn.Package) error
+}
+
+var indexers = []indexer{
+	{[][]byte{searchBucket}, updateSearchIndex},
+	{[][]byte{listingBucket, byStarsBucket, byUpdatedBucket}, updateListing},
+	{[][]byte{dependentsBucket}, updateDependents},
+	{[][]byte{includesBucket}, updateIncludes},
+}
+
+func updateIndexes(t *bolt.Tx, old, new pawn.Package) error {
+	for _, idx := range indexers {
+		if err := idx.update(t, old, new); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// needsReindex reports whether any index bucket is missing, which is the case for databases
+// created before that index existed, or an index is stored in an older form.
+func needsReindex(t *bolt.Tx) bool {
+	for _, idx := range indexers {
+		for _, b := range idx.buckets {
+			if t.Bucket(b) == nil {
+				return true
+			}
+		}
+	}
+	return legacyDependents(t)
+}
+
+// reindex drops every index bucket and rebuilds them from the packages bucket.
+func reindex(t *bolt.Tx) error {
+	for _, idx := range indexers {
+		for _, b := range idx.buckets {
+			if t.Bucket(b) != nil {
+				if err := t.DeleteBucket(b); err != nil {
+					return err
+				}
+			}
+			if _, err := t.CreateBucket(b); err != nil {
+				return err
+			}
+		}
+	}
+
+	bkt := t.Bucket(packagesBucket)
+	return bkt.ForEach(func(k, v []byte) error {
+		var e Entry
+		if err := json.Unmarshal(v, &e); err != nil {
+			return err
+		}
+		return updateIndexes(t, pawn.Package{}, e.Pkg)
+	})
+}
@@ -0,0 +1,221 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"time"
+
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/Southclaws/pawndex/pawn"
+)
+
+var (
+	listingBucket   = []byte("listing")
+	byStarsBucket   = []byte("by_stars")
+	byUpdatedBucket = []byte("by_updated")
+)
+
+// Sort specifies the order of packages returned from a query
+type Sort string
+
+var (
+	SortName    Sort = "name"
+	SortStars   Sort = "stars"
+	SortUpdated Sort = "updated"
+)
+
+// Query describes a filtered, sorted and paginated listing of packages. Zero values for filters
+// match everything and a zero Limit returns all matching packages.
+type Query struct {
+	Classification pawn.Classification
+	Topic          string
+	User           string
+	UpdatedSince   time.Time
+	MinStars       int
+	Sort           Sort
+	Cursor         string
+	Limit          int
+}
+
+// listing is a compact summary of a package, holding only the fields that can be filtered on so
+// queries don't need to deserialise every full entry.
+type listing struct {
+	User           string              `json:"u"`
+	Classification pawn.Classification `json:"c"`
+	Stars          int                 `json:"s"`
+	Updated        time.Time           `json:"t"`
+	Topics         []string            `json:"p,omitempty"`
+}
+
+func (l listing) matches(q Query) bool {
+	if q.Classification != "" && l.Classification != q.Classification {
+		return false
+	}
+	if q.User != "" && l.User != q.User {
+		return false
+	}
+	if l.Stars < q.MinStars {
+		return false
+	}
+	if !q.UpdatedSince.IsZero() && l.Updated.Before(q.UpdatedSince) {
+		return false
+	}
+	if q.Topic != "" {
+		for _, t := range l.Topics {
+			if t == q.Topic {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// sortKey prefixes a package name with a big-endian value so keys in the sort buckets are ordered
+// by that value first and by name second. Values are inverted so higher values come first.
+func sortKey(value uint64, name string) []byte {
+	key := make([]byte, 8, 8+len(name))
+	binary.BigEndian.PutUint64(key, math.MaxUint64-value)
+	return append(key, name...)
+}
+
+func starsKey(p pawn.Package) []byte {
+	return sortKey(uint64(p.Stars), p.String())
+}
+
+func updatedKey(p pawn.Package) []byte {
+	var unix uint64
+	if ts := p.Updated.Unix(); ts > 0 {
+		unix = uint64(ts)
+	}
+	return sortKey(unix, p.String())
+}
+
+func updateListing(t *bolt.Tx, old, new pawn.Package) error {
+	lst, err := t.CreateBucketIfNotExists(listingBucket)
+	if err != nil {
+		return err
+	}
+	stars, err := t.CreateBucketIfNotExists(byStarsBucket)
+	if err != nil {
+		return err
+	}
+	updated, err := t.CreateBucketIfNotExists(byUpdatedBucket)
+	if err != nil {
+		return err
+	}
+
+	if old.Repo != "" {
+		if err := lst.Delete([]byte(old.String())); err != nil {
+			return err
+		}
+		if err := stars.Delete(starsKey(old)); err != nil {
+			return err
+		}
+		if err := updated.Delete(updatedKey(old)); err != nil {
+			return err
+		}
+	}
+
+	if new.Repo != "" {
+		raw, err := json.Marshal(listing{
+			User:           new.User,
+			Classification: new.Classification,
+			Stars:          new.Stars,
+			Updated:        new.Updated,
+			Topics:         new.Topics,
+		})
+		if err != nil {
+			return err
+		}
+		if err := lst.Put([]byte(new.String()), raw); err != nil {
+			return err
+		}
+		if err := stars.Put(starsKey(new), nil); err != nil {
+			return err
+		}
+		if err := updated.Put(updatedKey(new), nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Query returns the packages that match the query along with a cursor for the next page, the
+// cursor is empty when there are no more results.
+func (db *DB) Query(q Query) (packages []pawn.Package, next string, err error) {
+	packages = []pawn.Package{}
+
+	var bucket []byte
+	switch q.Sort {
+	case SortName, "":
+		bucket = listingBucket
+	case SortStars:
+		bucket = byStarsBucket
+	case SortUpdated:
+		bucket = byUpdatedBucket
+	default:
+		return nil, "", errors.Errorf("unknown sort order '%s'", q.Sort)
+	}
+
+	cursor, err := base64.RawURLEncoding.DecodeString(q.Cursor)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "invalid cursor")
+	}
+
+	err = db.db.View(func(t *bolt.Tx) error {
+		lst := t.Bucket(listingBucket)
+		pkgs := t.Bucket(packagesBucket)
+		cur := t.Bucket(bucket).Cursor()
+
+		var k []byte
+		if len(cursor) > 0 {
+			k, _ = cur.Seek(cursor)
+			if bytes.Equal(k, cursor) {
+				k, _ = cur.Next()
+			}
+		} else {
+			k, _ = cur.First()
+		}
+
+		var last []byte
+		for ; k != nil; k, _ = cur.Next() {
+			name := k
+			if !bytes.Equal(bucket, listingBucket) {
+				name = k[8:]
+			}
+
+			var l listing
+			if err := json.Unmarshal(lst.Get(name), &l); err != nil {
+				return err
+			}
+			if !l.matches(q) {
+				continue
+			}
+			// only a full page with a matching package after it has a next page
+			if q.Limit > 0 && len(packages) == q.Limit {
+				next = base64.RawURLEncoding.EncodeToString(last)
+				break
+			}
+
+			var e Entry
+			if err := json.Unmarshal(pkgs.Get(name), &e); err != nil {
+				return err
+			}
+			packages = append(packages, e.Pkg)
+			last = k
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return
+}
@@ -0,0 +1,189 @@
+package storage
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/Southclaws/sampctl/pawnpackage"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/Southclaws/pawndex/pawn"
+)
+
+// migrateSites moves packages stored under user/repo names, from before packages were keyed by
+// the host they live on, to their canonical host/user/repo names. It reports whether anything was
+// migrated, in which case the indexes must be rebuilt.
+func migrateSites(t *bolt.Tx) (bool, error) {
+	bkt := t.Bucket(packagesBucket)
+
+	var legacy []string
+	if err := bkt.ForEach(func(k, v []byte) error {
+		if strings.Count(string(k), "/") == 1 {
+			legacy = append(legacy, string(k))
+		}
+		return nil
+	}); err != nil {
+		return false, err
+	}
+	if len(legacy) == 0 {
+		return false, nil
+	}
+
+	versions := t.Bucket(versionsBucket)
+	pkgSymbols := t.Bucket(packageSymbolsBucket)
+
+	for _, old := range legacy {
+		name := pawn.CanonicalName(old)
+
+		var e Entry
+		if err := json.Unmarshal(bkt.Get([]byte(old)), &e); err != nil {
+			return false, err
+		}
+		if e.Pkg.Repo != "" && e.Pkg.Site == "" {
+			e.Pkg.Site = pawn.DefaultSite
+		}
+		raw, err := json.Marshal(e)
+		if err != nil {
+			return false, err
+		}
+		if err := bkt.Put([]byte(name), raw); err != nil {
+			return false, err
+		}
+		if err := bkt.Delete([]byte(old)); err != nil {
+			return false, err
+		}
+
+		if versions != nil {
+			if err := renameBucket(versions, old, name); err != nil {
+				return false, err
+			}
+		}
+		if pkgSymbols != nil {
+			if err := renameBucket(pkgSymbols, old, name); err != nil {
+				return false, err
+			}
+		}
+	}
+
+	return true, rebuildSymbols(t)
+}
+
+// renameBucket moves a nested bucket to a new key
+func renameBucket(parent *bolt.Bucket, from, to string) error {
+	src := parent.Bucket([]byte(from))
+	if src == nil {
+		return nil
+	}
+	dst, err := parent.CreateBucketIfNotExists([]byte(to))
+	if err != nil {
+		return err
+	}
+	if err := src.ForEach(func(k, v []byte) error {
+		return dst.Put(k, v)
+	}); err != nil {
+		return err
+	}
+	return parent.DeleteBucket([]byte(from))
+}
+
+// migrateSymbols moves the symbols of each package, stored as a single list from before they were
+// stored per tag, to a bucket of the package's symbols at each tag. The commit they were found at
+// wasn't recorded, so every tag is read again on the package's next scrape. It reports whether
+// anything was migrated, in which case the symbol indexes must be rebuilt.
+func migrateSymbols(t *bolt.Tx) (bool, error) {
+	pkgSymbols := t.Bucket(packageSymbolsBucket)
+	if pkgSymbols == nil {
+		return false, nil
+	}
+
+	legacy := map[string][]pawn.Symbol{}
+	if err := pkgSymbols.ForEach(func(k, v []byte) error {
+		if v == nil {
+			return nil // already a bucket
+		}
+		var symbols []pawn.Symbol
+		if err := json.Unmarshal(v, &symbols); err != nil {
+			return err
+		}
+		legacy[string(k)] = symbols
+		return nil
+	}); err != nil {
+		return false, err
+	}
+	if len(legacy) == 0 {
+		return false, nil
+	}
+
+	for name, symbols := range legacy {
+		if err := pkgSymbols.Delete([]byte(name)); err != nil {
+			return false, err
+		}
+		sets, err := pkgSymbols.CreateBucket([]byte(name))
+		if err != nil {
+			return false, err
+		}
+		byTag := map[string][]pawn.Symbol{}
+		for _, s := range symbols {
+			byTag[s.Tag] = append(byTag[s.Tag], s)
+		}
+		for tag, symbols := range byTag {
+			raw, err := json.Marshal(symbolSet{Symbols: symbols})
+			if err != nil {
+				return false, err
+			}
+			if err := sets.Put(symbolSetKey(tag), raw); err != nil {
+				return false, err
+			}
+		}
+	}
+	return true, nil
+}
+
+// rebuildSymbols recreates the symbol and guard indexes from the symbols stored for each package
+func rebuildSymbols(t *bolt.Tx) error {
+	pkgSymbols := t.Bucket(packageSymbolsBucket)
+	if pkgSymbols == nil {
+		return nil
+	}
+	for _, b := range [][]byte{symbolsBucket, guardsBucket} {
+		if t.Bucket(b) != nil {
+			if err := t.DeleteBucket(b); err != nil {
+				return err
+			}
+		}
+	}
+
+	var packages []pawn.Package
+	if err := pkgSymbols.ForEach(func(k, v []byte) error {
+		meta, err := pawn.ParseName(string(k))
+		if err != nil {
+			return err
+		}
+		p := pawn.Package{Package: pawnpackage.Package{DependencyMeta: meta}, Commits: map[string]string{}}
+		if err := pkgSymbols.Bucket(k).ForEach(func(tag, v []byte) error {
+			var set symbolSet
+			if err := json.Unmarshal(v, &set); err != nil {
+				return err
+			}
+			p.Commits[symbolSetTag(tag)] = set.Commit
+			p.Symbols = append(p.Symbols, set.Symbols...)
+			return nil
+		}); err != nil {
+			return err
+		}
+		packages = append(packages, p)
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	for _, p := range packages {
+		if err := pkgSymbols.DeleteBucket([]byte(p.String())); err != nil {
+			return err
+		}
+		if err := putSymbols(t, p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
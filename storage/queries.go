@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"encoding/json"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// queriesBucket holds the state of each discovery query, keyed by the query
+var queriesBucket = []byte("queries")
+
+// QueryState records the schedule of a discovery query and how its recent runs went. A run that
+// succeeded lets the next run only search for repositories with activity since it started.
+type QueryState struct {
+	Query        string        `json:"query"`
+	Code         bool          `json:"code,omitempty"` // searched with code search
+	Interval     time.Duration `json:"interval"`       // time between runs
+	FullInterval time.Duration `json:"full_interval"`  // time between full searches
+	LastRun      time.Time     `json:"last_run"`       // start of the last run
+	Last         time.Time     `json:"last"`           // start of the last successful run, full or incremental
+	LastFull     time.Time     `json:"last_full"`      // start of the last successful full search
+	Full         bool          `json:"full"`           // whether the last run was a full search
+	Hits         int           `json:"hits"`           // repositories found by the last run
+	Error        string        `json:"error,omitempty"`
+}
+
+// GetQueries returns the state of every discovery query that has run
+func (db *DB) GetQueries() ([]QueryState, error) {
+	queries := []QueryState{}
+
+	if err := db.db.View(func(t *bolt.Tx) error {
+		bkt := t.Bucket(queriesBucket)
+		if bkt == nil {
+			return nil
+		}
+		return bkt.ForEach(func(k, v []byte) error {
+			var q QueryState
+			if err := json.Unmarshal(v, &q); err != nil {
+				return err
+			}
+			queries = append(queries, q)
+			return nil
+		})
+	}); err != nil {
+		return nil, err
+	}
+	return queries, nil
+}
+
+// SetQuery stores the state of a discovery query
+func (db *DB) SetQuery(q QueryState) error {
+	return db.db.Update(func(t *bolt.Tx) error {
+		bkt, err := t.CreateBucketIfNotExists(queriesBucket)
+		if err != nil {
+			return err
+		}
+		raw, err := json.Marshal(q)
+		if err != nil {
+			return err
+		}
+		return bkt.Put([]byte(q.Query), raw)
+	})
+}
+
+// DeleteQuery removes the state of a discovery query that is no longer configured
+func (db *DB) DeleteQuery(query string) error {
+	return db.db.Update(func(t *bolt.Tx) error {
+		bkt := t.Bucket(queriesBucket)
+		if bkt == nil {
+			return nil
+		}
+		return bkt.Delete([]byte(query))
+	})
+}
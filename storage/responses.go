@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"net/url"
+	"strings"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// responsesBucket holds cached HTTP responses, keyed by whatever identifies the request
+var responsesBucket = []byte("responses")
+
+// GetResponse returns a cached response
+func (db *DB) GetResponse(key string) (raw []byte, exists bool, err error) {
+	err = db.db.View(func(t *bolt.Tx) error {
+		bkt := t.Bucket(responsesBucket)
+		if bkt == nil {
+			return nil
+		}
+		if v := bkt.Get([]byte(key)); v != nil {
+			// the value is only valid for the life of the transaction
+			raw, exists = append([]byte{}, v...), true
+		}
+		return nil
+	})
+	return
+}
+
+// SetResponse caches a response, replacing the previous response with the same key
+func (db *DB) SetResponse(key string, raw []byte) error {
+	return db.db.Update(func(t *bolt.Tx) error {
+		bkt, err := t.CreateBucketIfNotExists(responsesBucket)
+		if err != nil {
+			return err
+		}
+		return bkt.Put([]byte(key), raw)
+	})
+}
+
+// deleteResponses removes the cached responses to requests for a repository. Which API host serves
+// a site isn't known here, so those for a repository of the same name on another host go too,
+// which only costs them a fresh request.
+func deleteResponses(t *bolt.Tx, user, repo string) error {
+	bkt := t.Bucket(responsesBucket)
+	if bkt == nil {
+		return nil
+	}
+
+	prefix := strings.ToLower("/repos/" + user + "/" + repo)
+	var keys [][]byte
+	if err := bkt.ForEach(func(k, v []byte) error {
+		// keys start with the URL of the request
+		u, err := url.Parse(strings.SplitN(string(k), " ", 2)[0])
+		if err != nil {
+			return nil
+		}
+		path := strings.ToLower(u.Path)
+		if i := strings.Index(path, "/repos/"); i != -1 {
+			path = path[i:]
+		}
+		if path == prefix || strings.HasPrefix(path, prefix+"/") {
+			keys = append(keys, append([]byte{}, k...))
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	for _, k := range keys {
+		if err := bkt.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
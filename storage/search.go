@@ -0,0 +1,213 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/Southclaws/pawndex/pawn"
+)
+
+var searchBucket = []byte("search")
+
+// field weights used when indexing a package, a term appearing in the repository name is a far
+// better signal than one that appears somewhere in the description.
+const (
+	weightRepo        = 4.0
+	weightUser        = 2.0
+	weightTopic       = 2.0
+	weightTag         = 1.0
+	weightDescription = 1.0
+)
+
+// postings maps a package name to the weighted frequency of a term within that package.
+type postings map[string]float64
+
+// tokenise splits text into lowercase alphanumeric terms.
+func tokenise(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// terms builds the weighted term frequencies for a package.
+func terms(p pawn.Package) map[string]float64 {
+	result := make(map[string]float64)
+	add := func(s string, weight float64) {
+		for _, t := range tokenise(s) {
+			result[t] += weight
+		}
+	}
+
+	// the whole names are also indexed so "samp-logger" matches exactly
+	result[strings.ToLower(p.Repo)] += weightRepo
+	result[strings.ToLower(p.User)] += weightUser
+
+	add(p.Repo, weightRepo)
+	add(p.User, weightUser)
+	add(p.Description, weightDescription)
+	for _, topic := range p.Topics {
+		add(topic, weightTopic)
+	}
+	for _, tag := range p.Tags {
+		add(tag, weightTag)
+	}
+
+	return result
+}
+
+// updateSearchIndex removes the terms of the previous version of a package from the index and
+// inserts the terms of the new one. Either may be empty.
+func updateSearchIndex(t *bolt.Tx, old, new pawn.Package) error {
+	bkt, err := t.CreateBucketIfNotExists(searchBucket)
+	if err != nil {
+		return err
+	}
+
+	if old.Repo != "" {
+		for term := range terms(old) {
+			if err := updatePostings(bkt, term, func(p postings) {
+				delete(p, old.String())
+			}); err != nil {
+				return err
+			}
+		}
+	}
+
+	if new.Repo != "" {
+		for term, weight := range terms(new) {
+			if err := updatePostings(bkt, term, func(p postings) {
+				p[new.String()] = weight
+			}); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func updatePostings(bkt *bolt.Bucket, term string, fn func(postings)) error {
+	p := postings{}
+	if raw := bkt.Get([]byte(term)); raw != nil {
+		if err := json.Unmarshal(raw, &p); err != nil {
+			return err
+		}
+	}
+
+	fn(p)
+
+	if len(p) == 0 {
+		return bkt.Delete([]byte(term))
+	}
+
+	raw, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	return bkt.Put([]byte(term), raw)
+}
+
+// rankBoost weighs a package's text relevance by how useful the package is likely to be.
+func rankBoost(p pawn.Package) float64 {
+	var classification float64
+	switch p.Classification {
+	case pawn.ClassificationPawnPackage:
+		classification = 1.5
+	case pawn.ClassificationBarebones:
+		classification = 1.0
+	default:
+		classification = 0.5
+	}
+	return classification * (1 + math.Log10(1+float64(p.Stars)))
+}
+
+// Search performs a full-text search over the index. Every term in the query must match, either
+// exactly or as a prefix of an indexed term, results are ordered by relevance.
+func (db *DB) Search(query string) ([]pawn.Package, error) {
+	packages := []pawn.Package{}
+
+	queryTerms := tokenise(query)
+	if len(queryTerms) == 0 {
+		return packages, nil
+	}
+
+	if err := db.db.View(func(t *bolt.Tx) error {
+		bkt := t.Bucket(searchBucket)
+		if bkt == nil {
+			return nil
+		}
+
+		var scores map[string]float64
+		for _, term := range queryTerms {
+			matches := make(map[string]float64)
+			prefix := []byte(term)
+			cur := bkt.Cursor()
+			for k, v := cur.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = cur.Next() {
+				p := postings{}
+				if err := json.Unmarshal(v, &p); err != nil {
+					return err
+				}
+
+				// exact matches are worth more than prefix matches and common terms are worth
+				// less than rare ones
+				weight := 0.5
+				if len(k) == len(prefix) {
+					weight = 1.0
+				}
+				weight /= math.Log(2 + float64(len(p)))
+
+				for name, tf := range p {
+					matches[name] += tf * weight
+				}
+			}
+
+			if scores == nil {
+				scores = matches
+				continue
+			}
+			for name := range scores {
+				if s, ok := matches[name]; ok {
+					scores[name] += s
+				} else {
+					delete(scores, name)
+				}
+			}
+		}
+
+		pkgs := t.Bucket(packagesBucket)
+		for name, score := range scores {
+			raw := pkgs.Get([]byte(name))
+			if raw == nil {
+				continue
+			}
+			var e Entry
+			if err := json.Unmarshal(raw, &e); err != nil {
+				return err
+			}
+			if e.Pkg.Repo == "" {
+				continue
+			}
+			packages = append(packages, e.Pkg)
+			scores[name] = score * rankBoost(e.Pkg)
+		}
+
+		sort.SliceStable(packages, func(i, j int) bool {
+			si, sj := scores[packages[i].String()], scores[packages[j].String()]
+			if si != sj {
+				return si > sj
+			}
+			return packages[i].String() < packages[j].String()
+		})
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return packages, nil
+}
@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"encoding/json"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/Southclaws/pawndex/pawn"
+)
+
+// ScrapeTime is when an indexed package was last scraped, along with what decides how often it
+// should be
+type ScrapeTime struct {
+	Name    string
+	Stars   int
+	Updated time.Time // when the repository was last updated, as of the last scrape
+	Scraped time.Time
+}
+
+// GetScrapeTimes returns when each indexed package that isn't marked for scraping was last scraped
+func (db *DB) GetScrapeTimes() ([]ScrapeTime, error) {
+	times := []ScrapeTime{}
+
+	if err := db.db.View(func(t *bolt.Tx) error {
+		return t.Bucket(packagesBucket).ForEach(func(k, v []byte) error {
+			var e Entry
+			if err := json.Unmarshal(v, &e); err != nil {
+				return err
+			}
+			if e.Pkg.Repo == "" || e.Marked {
+				return nil
+			}
+			times = append(times, ScrapeTime{
+				Name:    string(k),
+				Stars:   e.Pkg.Stars,
+				Updated: e.Pkg.Updated,
+				Scraped: e.Scraped,
+			})
+			return nil
+		})
+	}); err != nil {
+		return nil, err
+	}
+	return times, nil
+}
+
+// GetScraped returns when a package was last scraped, zero if it hasn't been or it's unknown
+func (db *DB) GetScraped(name string) (scraped time.Time, err error) {
+	name = pawn.CanonicalName(name)
+
+	err = db.db.View(func(t *bolt.Tx) error {
+		raw := t.Bucket(packagesBucket).Get([]byte(name))
+		if raw == nil {
+			return nil
+		}
+		var e Entry
+		if err := json.Unmarshal(raw, &e); err != nil {
+			return err
+		}
+		scraped = e.Scraped
+		return nil
+	})
+	return
+}
+
+// MarkStale marks an indexed package for scraping again, unlike MarkForScrape how it was found is
+// left as it is
+func (db *DB) MarkStale(name string) error {
+	name = pawn.CanonicalName(name)
+
+	return db.db.Update(func(t *bolt.Tx) error {
+		bkt := t.Bucket(packagesBucket)
+		raw := bkt.Get([]byte(name))
+		if raw == nil {
+			return nil
+		}
+
+		var e Entry
+		if err := json.Unmarshal(raw, &e); err != nil {
+			return err
+		}
+		e.Marked = true
+
+		raw, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		return bkt.Put([]byte(name), raw)
+	})
+}
@@ -1,12 +1,50 @@
 package storage
 
-import "github.com/Southclaws/pawndex/pawn"
+import (
+	"time"
+
+	"github.com/Southclaws/sampctl/pawnpackage"
+
+	"github.com/Southclaws/pawndex/pawn"
+)
 
 type Storer interface {
 	GetAll() ([]pawn.Package, error)
 	Get(string) (pawn.Package, bool, error)
+	Lookup(string) (pawn.Package, bool, error)
 	Set(pawn.Package) error
+	GetConflicts() ([]pawn.Conflict, error)
+	GetPackageConflicts(string) ([]pawn.Conflict, error)
+	GetDependents(string) ([]pawn.Package, error)
+	GetIncludes(string) ([]Include, error)
+	GetSymbols(string) ([]SymbolDeclaration, error)
+	GetVersion(string, string) (pawnpackage.Package, bool, error)
+	GetVersions(string) ([]pawnpackage.Package, error)
+	Search(string) ([]pawn.Package, error)
+	Query(Query) ([]pawn.Package, string, error)
 
 	MarkForScrape(string) error
+	MarkFound(string, Discovery) error
+	GetDiscovery(string) ([]Discovery, error)
+	Unmark(string) error
+	Delete(string) error
 	GetMarked() ([]string, error)
+	GetUnindexedDependencies(int) ([]Dependency, error)
+	MarkDependency(Dependency) error
+	GetFailure(string) (Failure, bool, error)
+	SetFailure(string, Failure) error
+	GetFailures() ([]Failure, error)
+	GetScrapeTimes() ([]ScrapeTime, error)
+	GetScraped(string) (time.Time, error)
+	MarkStale(string) error
+	Submit(string) (Submission, error)
+	GetSubmission(string) (Submission, bool, error)
+	RejectSubmissions(string, string) error
+	ResolveSubmissions(string) error
+
+	SetCoverage(pawn.SearchCoverage) error
+	GetCoverage() ([]pawn.SearchCoverage, error)
+	GetQueries() ([]QueryState, error)
+	SetQuery(QueryState) error
+	DeleteQuery(string) error
 }
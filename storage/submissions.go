@@ -0,0 +1,188 @@
+package storage
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/Southclaws/pawndex/pawn"
+)
+
+// submissionsBucket holds each submission, keyed by its ID
+var submissionsBucket = []byte("submissions")
+
+// SubmissionStatus is the progress of a submitted repository through the index
+type SubmissionStatus string
+
+var (
+	SubmissionQueued   SubmissionStatus = "queued"   // marked for scraping
+	SubmissionScraped  SubmissionStatus = "scraped"  // indexed as a package
+	SubmissionRejected SubmissionStatus = "rejected" // scraped but not indexed, see Reason
+)
+
+// Submission is a repository submitted for indexing by hand
+type Submission struct {
+	ID        string           `json:"id"`
+	Package   string           `json:"package"`
+	Status    SubmissionStatus `json:"status"`
+	Reason    string           `json:"reason,omitempty"` // why the submission was rejected
+	Submitted time.Time        `json:"submitted"`
+	Updated   time.Time        `json:"updated"`
+}
+
+// Submit marks a repository for scraping ahead of those found any other way and returns a
+// submission that follows it until it's scraped. A repository already waiting on a submission
+// isn't submitted again, the pending submission is returned instead.
+func (db *DB) Submit(name string) (s Submission, err error) {
+	name = pawn.CanonicalName(name)
+
+	err = db.db.Update(func(t *bolt.Tx) error {
+		bkt, err := t.CreateBucketIfNotExists(packagesBucket)
+		if err != nil {
+			return err
+		}
+
+		var e Entry
+		if raw := bkt.Get([]byte(name)); raw != nil {
+			if err := json.Unmarshal(raw, &e); err != nil {
+				return err
+			}
+		}
+		if len(e.Submissions) > 0 {
+			raw := t.Bucket(submissionsBucket).Get([]byte(e.Submissions[len(e.Submissions)-1]))
+			if raw != nil {
+				return json.Unmarshal(raw, &s)
+			}
+		}
+
+		id := make([]byte, 8)
+		if _, err := rand.Read(id); err != nil {
+			return err
+		}
+		now := time.Now().UTC()
+		s = Submission{
+			ID:        hex.EncodeToString(id),
+			Package:   name,
+			Status:    SubmissionQueued,
+			Submitted: now,
+			Updated:   now,
+		}
+
+		e.Marked = true
+		e.Depth = 0
+		e.addDiscovery(Discovery{Source: SourceSubmission, Time: now})
+		e.Submissions = append(e.Submissions, s.ID)
+		// a submission is a request to try again, however the repository failed before
+		e.Failure = nil
+
+		raw, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		if err := bkt.Put([]byte(name), raw); err != nil {
+			return err
+		}
+		return putSubmission(t, s)
+	})
+	return
+}
+
+// GetSubmission returns a submission by its ID
+func (db *DB) GetSubmission(id string) (s Submission, exists bool, err error) {
+	err = db.db.View(func(t *bolt.Tx) error {
+		bkt := t.Bucket(submissionsBucket)
+		if bkt == nil {
+			return nil
+		}
+		raw := bkt.Get([]byte(id))
+		if raw == nil {
+			return nil
+		}
+		exists = true
+		return json.Unmarshal(raw, &s)
+	})
+	return
+}
+
+// RejectSubmissions rejects the pending submissions of a repository with the reason it wasn't
+// indexed
+func (db *DB) RejectSubmissions(name, reason string) error {
+	return db.finishSubmissions(name, SubmissionRejected, reason)
+}
+
+// ResolveSubmissions marks the pending submissions of a repository as scraped, for a repository
+// that was indexed under another name than it was submitted with, such as after a rename
+func (db *DB) ResolveSubmissions(name string) error {
+	return db.finishSubmissions(name, SubmissionScraped, "")
+}
+
+// finishSubmissions sets the final status of the pending submissions of a repository
+func (db *DB) finishSubmissions(name string, status SubmissionStatus, reason string) error {
+	name = pawn.CanonicalName(name)
+
+	return db.db.Update(func(t *bolt.Tx) error {
+		bkt := t.Bucket(packagesBucket)
+		raw := bkt.Get([]byte(name))
+		if raw == nil {
+			return nil
+		}
+
+		var e Entry
+		if err := json.Unmarshal(raw, &e); err != nil {
+			return err
+		}
+		if len(e.Submissions) == 0 {
+			return nil
+		}
+		if err := resolveSubmissions(t, e.Submissions, status, reason); err != nil {
+			return err
+		}
+		e.Submissions = nil
+
+		raw, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		return bkt.Put([]byte(name), raw)
+	})
+}
+
+// resolveSubmissions sets the final status of each of the given submissions
+func resolveSubmissions(t *bolt.Tx, ids []string, status SubmissionStatus, reason string) error {
+	bkt := t.Bucket(submissionsBucket)
+	if bkt == nil {
+		return nil
+	}
+	for _, id := range ids {
+		raw := bkt.Get([]byte(id))
+		if raw == nil {
+			continue
+		}
+		var s Submission
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return err
+		}
+		s.Status = status
+		s.Reason = reason
+		s.Updated = time.Now().UTC()
+		if err := putSubmission(t, s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func putSubmission(t *bolt.Tx, s Submission) error {
+	bkt, err := t.CreateBucketIfNotExists(submissionsBucket)
+	if err != nil {
+		return err
+	}
+	raw, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return bkt.Put([]byte(s.ID), raw)
+}
@@ -0,0 +1,300 @@
+package storage
+
+import (
+	"encoding/json"
+	"sort"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/Southclaws/pawndex/pawn"
+)
+
+var (
+	// symbolsBucket maps a symbol name to every declaration of it in the index
+	symbolsBucket = []byte("symbols")
+	// packageSymbolsBucket holds one nested bucket per package, each mapping a tag to the symbols
+	// found at it, so they can be removed from the symbols bucket when the tag is next stored
+	packageSymbolsBucket = []byte("package_symbols")
+	// guardsBucket maps an include guard to the names of the packages that define it at the head of
+	// their default branch
+	guardsBucket = []byte("guards")
+)
+
+// headKey keys the symbols of a package's default branch in its packageSymbolsBucket bucket, ':'
+// can't appear in a git ref so it can't clash with a tag
+const headKey = ":head"
+
+// SymbolDeclaration is a symbol and the package that declares it
+type SymbolDeclaration struct {
+	Package string `json:"package"`
+	pawn.Symbol
+}
+
+// symbolSet is the stored form of the symbols of a package at a tag, or the head of its default
+// branch, and the commit they were found at
+type symbolSet struct {
+	Commit  string        `json:"commit"`
+	Symbols []pawn.Symbol `json:"symbols"`
+}
+
+func symbolSetKey(tag string) []byte {
+	if tag == "" {
+		return []byte(headKey)
+	}
+	return []byte(tag)
+}
+
+func symbolSetTag(key []byte) string {
+	if string(key) == headKey {
+		return ""
+	}
+	return string(key)
+}
+
+// putSymbols stores the symbols attached to a package, per tag. The symbols of a tag in the
+// package's Commits that it has none attached for are kept if they were found at the same commit,
+// so a scrape doesn't have to read tags again that haven't moved. The symbols of any other tag
+// not in the package are removed.
+func putSymbols(t *bolt.Tx, p pawn.Package) error {
+	symbols, err := t.CreateBucketIfNotExists(symbolsBucket)
+	if err != nil {
+		return err
+	}
+	pkgSymbols, err := t.CreateBucketIfNotExists(packageSymbolsBucket)
+	if err != nil {
+		return err
+	}
+	guards, err := t.CreateBucketIfNotExists(guardsBucket)
+	if err != nil {
+		return err
+	}
+
+	name := p.String()
+
+	byTag := map[string][]pawn.Symbol{}
+	for _, s := range p.Symbols {
+		byTag[s.Tag] = append(byTag[s.Tag], s)
+	}
+	for tag := range p.Commits {
+		if _, ok := byTag[tag]; !ok {
+			byTag[tag] = nil
+		}
+	}
+	tags := make([]string, 0, len(byTag))
+	for tag := range byTag {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+
+	sets, err := pkgSymbols.CreateBucketIfNotExists([]byte(name))
+	if err != nil {
+		return err
+	}
+
+	var gone []string
+	if err := sets.ForEach(func(k, v []byte) error {
+		if _, ok := byTag[symbolSetTag(k)]; !ok {
+			gone = append(gone, symbolSetTag(k))
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	for _, tag := range gone {
+		if err := removeSymbolSet(sets, symbols, guards, name, tag); err != nil {
+			return err
+		}
+	}
+
+	for _, tag := range tags {
+		if raw := sets.Get(symbolSetKey(tag)); raw != nil {
+			var old symbolSet
+			if err := json.Unmarshal(raw, &old); err != nil {
+				return err
+			}
+			if byTag[tag] == nil && old.Commit == p.Commits[tag] {
+				continue
+			}
+			if err := removeSymbolSet(sets, symbols, guards, name, tag); err != nil {
+				return err
+			}
+		}
+		if err := addSymbolSet(sets, symbols, guards, name, tag, symbolSet{p.Commits[tag], byTag[tag]}); err != nil {
+			return err
+		}
+	}
+
+	if k, _ := sets.Cursor().First(); k == nil {
+		return pkgSymbols.DeleteBucket([]byte(name))
+	}
+	return nil
+}
+
+// addSymbolSet stores the symbols of a package at a tag and adds them to the symbol and guard
+// indexes
+func addSymbolSet(sets, symbols, guards *bolt.Bucket, name, tag string, set symbolSet) error {
+	if tag == "" {
+		for _, s := range set.Symbols {
+			if s.Kind != pawn.SymbolGuard {
+				continue
+			}
+			if err := updateList(guards, s.Name, func(names []string) []string {
+				return insertString(names, name)
+			}); err != nil {
+				return err
+			}
+		}
+	}
+
+	byName := map[string][]SymbolDeclaration{}
+	for _, s := range set.Symbols {
+		byName[s.Name] = append(byName[s.Name], SymbolDeclaration{name, s})
+	}
+	for s, decls := range byName {
+		decls := decls
+		if err := updateDeclarations(symbols, s, func(existing []SymbolDeclaration) []SymbolDeclaration {
+			return append(existing, decls...)
+		}); err != nil {
+			return err
+		}
+	}
+
+	raw, err := json.Marshal(set)
+	if err != nil {
+		return err
+	}
+	return sets.Put(symbolSetKey(tag), raw)
+}
+
+// removeSymbolSet removes the symbols of a package at a tag and their entries in the symbol and
+// guard indexes
+func removeSymbolSet(sets, symbols, guards *bolt.Bucket, name, tag string) error {
+	raw := sets.Get(symbolSetKey(tag))
+	if raw == nil {
+		return nil
+	}
+	var set symbolSet
+	if err := json.Unmarshal(raw, &set); err != nil {
+		return err
+	}
+
+	for _, s := range uniqueNames(set.Symbols) {
+		if err := updateDeclarations(symbols, s, func(decls []SymbolDeclaration) []SymbolDeclaration {
+			result := decls[:0]
+			for _, d := range decls {
+				if d.Package != name || d.Tag != tag {
+					result = append(result, d)
+				}
+			}
+			return result
+		}); err != nil {
+			return err
+		}
+	}
+
+	if tag == "" {
+		for _, s := range set.Symbols {
+			if s.Kind != pawn.SymbolGuard {
+				continue
+			}
+			if err := updateList(guards, s.Name, func(names []string) []string {
+				return removeString(names, name)
+			}); err != nil {
+				return err
+			}
+		}
+	}
+
+	return sets.Delete(symbolSetKey(tag))
+}
+
+func uniqueNames(symbols []pawn.Symbol) (names []string) {
+	seen := map[string]bool{}
+	for _, s := range symbols {
+		if !seen[s.Name] {
+			seen[s.Name] = true
+			names = append(names, s.Name)
+		}
+	}
+	return
+}
+
+func updateDeclarations(bkt *bolt.Bucket, key string, fn func([]SymbolDeclaration) []SymbolDeclaration) error {
+	var decls []SymbolDeclaration
+	if raw := bkt.Get([]byte(key)); raw != nil {
+		if err := json.Unmarshal(raw, &decls); err != nil {
+			return err
+		}
+	}
+
+	decls = fn(decls)
+
+	if len(decls) == 0 {
+		return bkt.Delete([]byte(key))
+	}
+	raw, err := json.Marshal(decls)
+	if err != nil {
+		return err
+	}
+	return bkt.Put([]byte(key), raw)
+}
+
+// GetSymbols returns every declaration of a symbol in the index
+func (db *DB) GetSymbols(name string) ([]SymbolDeclaration, error) {
+	decls := []SymbolDeclaration{}
+
+	if err := db.db.View(func(t *bolt.Tx) error {
+		bkt := t.Bucket(symbolsBucket)
+		if bkt == nil {
+			return nil
+		}
+		raw := bkt.Get([]byte(name))
+		if raw == nil {
+			return nil
+		}
+		return json.Unmarshal(raw, &decls)
+	}); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(decls, func(i, j int) bool {
+		if decls[i].Package != decls[j].Package {
+			return decls[i].Package < decls[j].Package
+		}
+		return decls[i].Tag < decls[j].Tag
+	})
+
+	return decls, nil
+}
+
+// GetIndexedCommits returns the commit each tag of a package was indexed at, with the default
+// branch under an empty tag, so a scrape can skip the tags that haven't moved since
+func (db *DB) GetIndexedCommits(name string) (map[string]string, error) {
+	name = pawn.CanonicalName(name)
+
+	commits := map[string]string{}
+
+	if err := db.db.View(func(t *bolt.Tx) error {
+		pkgSymbols := t.Bucket(packageSymbolsBucket)
+		if pkgSymbols == nil {
+			return nil
+		}
+		sets := pkgSymbols.Bucket([]byte(name))
+		if sets == nil {
+			return nil
+		}
+		return sets.ForEach(func(k, v []byte) error {
+			var set symbolSet
+			if err := json.Unmarshal(v, &set); err != nil {
+				return err
+			}
+			if set.Commit != "" {
+				commits[symbolSetTag(k)] = set.Commit
+			}
+			return nil
+		})
+	}); err != nil {
+		return nil, err
+	}
+	return commits, nil
+}
@@ -0,0 +1,144 @@
+package storage
+
+import (
+	"encoding/json"
+
+	"github.com/Southclaws/sampctl/pawnpackage"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/Southclaws/pawndex/pawn"
+)
+
+// versionsBucket holds one nested bucket per package, each mapping a tag to the package definition
+// that was declared at that tag.
+var versionsBucket = []byte("versions")
+
+// putVersions stores the versions attached to a package and removes those of tags that no longer
+// exist, or that were read again at another commit. Versions of tags that still exist are kept when
+// they're missing from the package, so a scrape that skipped or failed to read some definitions
+// doesn't lose them.
+func putVersions(t *bolt.Tx, p pawn.Package) error {
+	bkt, err := t.CreateBucketIfNotExists(versionsBucket)
+	if err != nil {
+		return err
+	}
+
+	name := []byte(p.String())
+	tags := map[string]bool{}
+	for _, tag := range p.Tags {
+		tags[tag] = true
+	}
+	if existing := bkt.Bucket(name); existing != nil {
+		var gone [][]byte
+		kept := 0
+		if err := existing.ForEach(func(k, v []byte) error {
+			if !tags[string(k)] {
+				gone = append(gone, k)
+				return nil
+			}
+			if commit, ok := p.Commits[string(k)]; ok {
+				var version pawnpackage.Package
+				if err := json.Unmarshal(v, &version); err != nil {
+					return err
+				}
+				if version.Commit != commit {
+					gone = append(gone, k) // the tag moved to a commit without a definition
+					return nil
+				}
+			}
+			kept++
+			return nil
+		}); err != nil {
+			return err
+		}
+		if kept == 0 {
+			if err := bkt.DeleteBucket(name); err != nil {
+				return err
+			}
+		} else {
+			for _, k := range gone {
+				if err := existing.Delete(k); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if len(p.Versions) == 0 {
+		return nil
+	}
+
+	versions, err := bkt.CreateBucketIfNotExists(name)
+	if err != nil {
+		return err
+	}
+	for _, v := range p.Versions {
+		raw, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		if err := versions.Put([]byte(v.Tag), raw); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetVersion returns the package definition of a package at a specific tag
+func (db *DB) GetVersion(name, tag string) (pkg pawnpackage.Package, exists bool, err error) {
+	name = pawn.CanonicalName(name)
+
+	if err := db.db.View(func(t *bolt.Tx) error {
+		bkt := t.Bucket(versionsBucket)
+		if bkt == nil {
+			return nil
+		}
+		versions := bkt.Bucket([]byte(name))
+		if versions == nil {
+			return nil
+		}
+
+		raw := versions.Get([]byte(tag))
+		if raw == nil {
+			return nil
+		}
+		if err := json.Unmarshal(raw, &pkg); err != nil {
+			return err
+		}
+		exists = true
+
+		return nil
+	}); err != nil {
+		return pkg, false, err
+	}
+	return
+}
+
+// GetVersions returns the package definitions of every tag of a package
+func (db *DB) GetVersions(name string) ([]pawnpackage.Package, error) {
+	name = pawn.CanonicalName(name)
+
+	packages := []pawnpackage.Package{}
+
+	if err := db.db.View(func(t *bolt.Tx) error {
+		bkt := t.Bucket(versionsBucket)
+		if bkt == nil {
+			return nil
+		}
+		versions := bkt.Bucket([]byte(name))
+		if versions == nil {
+			return nil
+		}
+
+		return versions.ForEach(func(k, v []byte) error {
+			var pkg pawnpackage.Package
+			if err := json.Unmarshal(v, &pkg); err != nil {
+				return err
+			}
+			packages = append(packages, pkg)
+			return nil
+		})
+	}); err != nil {
+		return nil, err
+	}
+	return packages, nil
+}
@@ -0,0 +1,30 @@
+// Package storagetest provides a throwaway database for tests of the packages built on storage.
+package storagetest
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Southclaws/pawndex/storage"
+)
+
+// NewStore opens an empty database in a temporary directory, both are removed when the test ends
+func NewStore(t testing.TB) *storage.DB {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "pawndex")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	db, err := storage.New(filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}